@@ -0,0 +1,89 @@
+// Package apperrors defines the typed errors the service reports to clients.
+// Each carries a Kind, which the routes map to an HTTP status, and a stable
+// Code that clients can branch on instead of the message.
+package apperrors
+
+import (
+	"errors"
+)
+
+type Kind int
+
+const (
+	// Internal is anything the client cannot do anything about
+	Internal Kind = iota
+	NotFound
+	// Full means the workshop has no seats left
+	Full
+	AlreadyRegistered
+	NotRegistered
+	// Validation means the request itself is malformed; Fields says where
+	Validation
+	// Conflict means the request clashes with the workshop's current state
+	Conflict
+	// Closed means the workshop no longer takes the request, e.g. after its
+	// registration deadline
+	Closed
+	// PreconditionFailed means an If-Match header did not match
+	PreconditionFailed
+	// Unavailable means the request could not be served right now, e.g.
+	// because it was cancelled before the store answered
+	Unavailable
+	// Unauthenticated means the request carried no valid bearer token
+	Unauthenticated
+	// Forbidden means the caller may not act for that user or workshop
+	Forbidden
+	// RateLimited means the caller sent too many requests and should retry
+	// later
+	RateLimited
+	// Unprocessable means the request is well formed but cannot be acted
+	// on, e.g. because it reuses an Idempotency-Key for a different request
+	Unprocessable
+)
+
+// Error is a domain error. Message is meant for people and may change; Code
+// is meant for programs and does not.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Fields maps field names to what is wrong with them, for Validation
+	Fields map[string]string
+}
+
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// NewValidation returns a Validation error with field level details.
+func NewValidation(code string, message string, fields map[string]string) *Error {
+	return &Error{Kind: Validation, Code: code, Message: message, Fields: fields}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// fieldError is implemented by errors about a single field, such as
+// models.FieldError.
+type fieldError interface {
+	error
+	FieldErrors() map[string]string
+}
+
+// internal is what clients see of an error the service did not expect.
+var internal = New(Internal, "internal", "Something went wrong on our side, please try again later.")
+
+// From finds the domain error in err's chain. Field errors become Validation
+// errors, and anything else an Internal error that hides the original.
+func From(err error) *Error {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+	var fieldErr fieldError
+	if errors.As(err, &fieldErr) {
+		return NewValidation("validation_failed", fieldErr.Error(), fieldErr.FieldErrors())
+	}
+	return internal
+}
@@ -0,0 +1,136 @@
+// Package auth authenticates callers by the JSON Web Tokens they send as
+// bearer tokens.
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"workshop/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// leeway allows for clocks that are slightly out of step with the issuer's.
+const leeway = 30 * time.Second
+
+// reloadInterval is how often a token signed with an unknown key may have
+// the JWKS file read again, so keys rotated into the file are picked up
+// without letting every bad token cause a read.
+const reloadInterval = time.Minute
+
+// Identity is who a token was issued to.
+type Identity struct {
+	// Subject is the token's sub claim, the caller's user ID
+	Subject string
+	// Admin is set when the token lists the admin role
+	Admin bool
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+// Authenticator checks tokens against the configured keys, issuer and
+// audience. Every token must name a subject and expire.
+type Authenticator struct {
+	parser    *jwt.Parser
+	adminRole string
+	secret    []byte
+
+	jwksFile string
+	mu       sync.Mutex
+	keys     map[string]*rsa.PublicKey
+	loadedAt time.Time
+}
+
+// New returns an authenticator for cfg, reading its key files.
+func New(cfg config.Auth) (*Authenticator, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{cfg.Algorithm}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	a := &Authenticator{parser: jwt.NewParser(options...), adminRole: cfg.AdminRole}
+	switch {
+	case cfg.Algorithm == config.JWTHS256:
+		a.secret = []byte(cfg.Secret)
+	case cfg.JWKSFile != "":
+		a.jwksFile = cfg.JWKSFile
+		keys, err := readJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys, a.loadedAt = keys, time.Now()
+	default:
+		contents, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the JWT public key: %w", err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(contents)
+		if err != nil {
+			return nil, fmt.Errorf("JWT public key %s: %w", cfg.PublicKeyFile, err)
+		}
+		// a single key signs every token, whatever kid they name
+		a.keys = map[string]*rsa.PublicKey{"": key}
+	}
+	return a, nil
+}
+
+// Authenticate checks token and returns who it was issued to.
+func (a *Authenticator) Authenticate(token string) (Identity, error) {
+	var c claims
+	if _, err := a.parser.ParseWithClaims(token, &c, a.key); err != nil {
+		return Identity{}, err
+	}
+	if c.Subject == "" {
+		return Identity{}, errors.New("token has no subject")
+	}
+	identity := Identity{Subject: c.Subject}
+	for _, role := range c.Roles {
+		if role == a.adminRole {
+			identity.Admin = true
+		}
+	}
+	return identity, nil
+}
+
+// key finds the key token was signed with. The parser has already checked
+// that the token uses the configured algorithm.
+func (a *Authenticator) key(token *jwt.Token) (interface{}, error) {
+	if a.secret != nil {
+		return a.secret, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key, ok := a.keys[""]; ok {
+		return key, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(a.loadedAt) >= reloadInterval {
+		a.loadedAt = time.Now()
+		keys, err := readJWKS(a.jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = keys
+		if key, ok := a.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no key with kid %q", kid)
+}
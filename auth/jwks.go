@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// jwks is a JSON Web Key Set, as published by most identity providers.
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// readJWKS reads the RSA signing keys in a JWKS file, by kid. Keys of other
+// types, or meant for encryption, are skipped.
+func readJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading the JWKS file: %w", err)
+	}
+	var set jwks
+	if err := json.Unmarshal(contents, &set); err != nil {
+		return nil, fmt.Errorf("JWKS file %s is not a key set: %w", path, err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || key.Use == "enc" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(key.N)
+		e, errE := base64.RawURLEncoding.DecodeString(key.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("JWKS file %s: key %q is malformed", path, key.Kid)
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS file " + path + " holds no RSA signing keys")
+	}
+	return keys, nil
+}
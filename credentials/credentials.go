@@ -0,0 +1,108 @@
+// Package credentials supplies the AWS credentials the service uses for
+// DynamoDB, from whichever source the configuration names, and keeps the
+// secrets involved out of the logs.
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"workshop/config"
+
+	awsv2config "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// retryAfterFailure is how soon a failed refresh is tried again. Until then
+// the last credentials that were fetched stay in use.
+const retryAfterFailure = time.Minute
+
+// New returns the credentials named by cfg, or nil for config.CredentialsDefault
+// so the SDK falls back to its default provider chain.
+func New(ctx context.Context, cfg config.Config) (*awscredentials.Credentials, error) {
+	c := cfg.Credentials
+	switch c.Source {
+	case config.CredentialsStatic:
+		Register(c.SecretAccessKey, c.SessionToken)
+		slog.Info("using static AWS credentials", "access_key_id", RedactAccessKeyID(c.AccessKeyID))
+		return awscredentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, c.SessionToken), nil
+	case config.CredentialsSecretsManager:
+		// Secrets Manager itself is reached with the default provider chain,
+		// e.g. the task role
+		awsConfig, err := awsv2config.LoadDefaultConfig(ctx, awsv2config.WithRegion(cfg.Region))
+		if err != nil {
+			return nil, fmt.Errorf("loading the AWS config for Secrets Manager: %w", err)
+		}
+		return awscredentials.NewCredentials(NewSecretsManagerProvider(secretsmanager.NewFromConfig(awsConfig), c.SecretID, c.Refresh)), nil
+	case config.CredentialsFile:
+		return awscredentials.NewCredentials(NewFileProvider(c.File, c.Refresh)), nil
+	default:
+		slog.Info("using the default AWS credential chain")
+		return nil, nil
+	}
+}
+
+// secretValue is the JSON shape of a credentials secret or file.
+type secretValue struct {
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	AWSSessionToken    string
+}
+
+// parseSecretValue decodes a secret or file without ever quoting it back in
+// an error, since the input is itself a secret.
+func parseSecretValue(contents []byte, source string) (awscredentials.Value, error) {
+	var secret secretValue
+	if err := json.Unmarshal(contents, &secret); err != nil {
+		return awscredentials.Value{}, fmt.Errorf("%s is not a JSON object with AWSAccessKeyID and AWSSecretAccessKey", source)
+	}
+	if secret.AWSAccessKeyID == "" || secret.AWSSecretAccessKey == "" {
+		return awscredentials.Value{}, fmt.Errorf("%s is missing AWSAccessKeyID or AWSSecretAccessKey", source)
+	}
+	return awscredentials.Value{
+		AccessKeyID:     secret.AWSAccessKeyID,
+		SecretAccessKey: secret.AWSSecretAccessKey,
+		SessionToken:    secret.AWSSessionToken,
+	}, nil
+}
+
+// refreshingProvider is an SDK credentials provider that fetches its
+// credentials again once refresh has passed, so rotated secrets are picked
+// up. A failed refresh keeps the previous credentials for a while rather than
+// failing every request.
+type refreshingProvider struct {
+	awscredentials.Expiry
+	name    string
+	refresh time.Duration
+	fetch   func() (awscredentials.Value, error)
+
+	mu   sync.Mutex
+	last *awscredentials.Value
+}
+
+func (p *refreshingProvider) Retrieve() (awscredentials.Value, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	value, err := p.fetch()
+	if err != nil {
+		if p.last == nil {
+			return awscredentials.Value{}, err
+		}
+		slog.Warn("refreshing AWS credentials failed, keeping the current ones", "source", p.name, "error", err.Error())
+		p.SetExpiration(time.Now().Add(min(retryAfterFailure, p.refresh)), 0)
+		return *p.last, nil
+	}
+	Register(value.SecretAccessKey, value.SessionToken)
+	value.ProviderName = p.name
+	if p.last == nil || p.last.AccessKeyID != value.AccessKeyID {
+		slog.Info("loaded AWS credentials", "access_key_id", RedactAccessKeyID(value.AccessKeyID), "source", p.name)
+	}
+	p.last = &value
+	p.SetExpiration(time.Now().Add(p.refresh), 0)
+	return value, nil
+}
@@ -0,0 +1,26 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// NewFileProvider reads credentials from a JSON file shaped like the Secrets
+// Manager secret, and reads it again every refresh. It is meant for local
+// development.
+func NewFileProvider(path string, refresh time.Duration) awscredentials.Provider {
+	return &refreshingProvider{
+		name:    "file " + path,
+		refresh: refresh,
+		fetch: func() (awscredentials.Value, error) {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				return awscredentials.Value{}, fmt.Errorf("reading credentials file: %w", err)
+			}
+			return parseSecretValue(contents, "credentials file "+path)
+		},
+	}
+}
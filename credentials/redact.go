@@ -0,0 +1,66 @@
+package credentials
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// minSecretLength keeps short values from being registered, since replacing
+// them would mangle unrelated log output.
+const minSecretLength = 8
+
+var secrets = struct {
+	sync.RWMutex
+	values map[string]bool
+}{values: map[string]bool{}}
+
+// Register adds values to the secrets redacted from the logs. Every provider
+// registers what it loads, so rotated secrets are covered too.
+func Register(values ...string) {
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, value := range values {
+		if len(value) >= minSecretLength {
+			secrets.values[value] = true
+		}
+	}
+}
+
+// Redact replaces every registered secret in s.
+func Redact(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for value := range secrets.values {
+		s = strings.ReplaceAll(s, value, redacted)
+	}
+	return s
+}
+
+// RedactAccessKeyID keeps only the last four characters of an access key ID,
+// enough to tell keys apart in the logs.
+func RedactAccessKeyID(accessKeyID string) string {
+	if len(accessKeyID) <= 4 {
+		return redacted
+	}
+	return strings.Repeat("*", len(accessKeyID)-4) + accessKeyID[len(accessKeyID)-4:]
+}
+
+// RedactingWriter redacts every registered secret from what is written to w.
+// main writes every log record through it so no log line can leak a secret.
+func RedactingWriter(w io.Writer) io.Writer {
+	return redactingWriter{w}
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,47 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// secretFetchTimeout bounds a read of the secret. Requests wait on it while
+// their credentials are refreshed, so a hung call must not hold them forever.
+const secretFetchTimeout = 10 * time.Second
+
+// SecretsManagerClient is the part of the Secrets Manager client the
+// provider needs.
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// NewSecretsManagerProvider reads credentials from the current version of a
+// Secrets Manager secret, a JSON object with AWSAccessKeyID and
+// AWSSecretAccessKey, and reads it again every refresh.
+func NewSecretsManagerProvider(client SecretsManagerClient, secretID string, refresh time.Duration) awscredentials.Provider {
+	return &refreshingProvider{
+		name:    "Secrets Manager secret " + secretID,
+		refresh: refresh,
+		fetch: func() (awscredentials.Value, error) {
+			input := &secretsmanager.GetSecretValueInput{
+				SecretId:     aws.String(secretID),
+				VersionStage: aws.String("AWSCURRENT"),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+			defer cancel()
+			result, err := client.GetSecretValue(ctx, input)
+			if err != nil {
+				return awscredentials.Value{}, fmt.Errorf("getting secret %s: %w", secretID, err)
+			}
+			if result.SecretString == nil {
+				return awscredentials.Value{}, fmt.Errorf("secret %s has no string value", secretID)
+			}
+			return parseSecretValue([]byte(*result.SecretString), "secret "+secretID)
+		},
+	}
+}
@@ -0,0 +1,114 @@
+// Package events describes what happens to workshops, and hands those events
+// on to other services.
+package events
+
+import (
+	"context"
+	"time"
+
+	"workshop/models"
+
+	"github.com/google/uuid"
+)
+
+// The event types double as the RabbitMQ routing keys, so consumers can bind
+// to workshop.* or attendee.*.
+const (
+	TypeWorkshopCreated    = "workshop.created"
+	TypeWorkshopUpdated    = "workshop.updated"
+	TypeWorkshopDeleted    = "workshop.deleted"
+	TypeAttendeeRegistered = "attendee.registered"
+	TypeAttendeeWithdrew   = "attendee.withdrew"
+
+	// a workshop that changes status announces its new one
+	TypeWorkshopPublished          = "workshop." + models.StatusPublished
+	TypeWorkshopRegistrationClosed = "workshop." + models.StatusRegistrationClosed
+	TypeWorkshopCancelled          = "workshop." + models.StatusCancelled
+	TypeWorkshopCompleted          = "workshop." + models.StatusCompleted
+)
+
+// Event is something that happened to a workshop. Every event names the
+// workshop both by its Workshop_Id and by its Creator_Id and
+// Creation_Timestamp.
+type Event struct {
+	// Event_Id is unique to the event. Events can be delivered more than
+	// once, so consumers should use it to drop the repeats.
+	Event_Id           string
+	Type               string
+	Occurred_At        time.Time
+	Workshop_Id        string
+	Creator_Id         string
+	Creation_Timestamp string
+	// Workshop is the workshop as it is after it was created or updated
+	Workshop *models.Workshop `json:",omitempty"`
+	// User_Id is the user who registered or withdrew
+	User_Id string `json:",omitempty"`
+	// Waitlisted is set when a registration only got a place on the
+	// waitlist, and when a user withdrew from the waitlist rather than a seat
+	Waitlisted bool `json:",omitempty"`
+	// Promoted is set when a user registered by moving off the waitlist into
+	// a seat someone else withdrew from, or one a patch added
+	Promoted bool `json:",omitempty"`
+}
+
+// Publisher hands events on. Once Publish returns without an error the
+// events will reach their consumers, eventually.
+type Publisher interface {
+	Publish(ctx context.Context, events ...Event) error
+}
+
+func newEvent(eventType string, workshopID string, creatorID string, creationTimestamp string) Event {
+	return Event{
+		Event_Id:           uuid.NewString(),
+		Type:               eventType,
+		Occurred_At:        time.Now().UTC(),
+		Workshop_Id:        workshopID,
+		Creator_Id:         creatorID,
+		Creation_Timestamp: creationTimestamp,
+	}
+}
+
+func WorkshopCreated(workshop models.Workshop) Event {
+	event := newEvent(TypeWorkshopCreated, workshop.Workshop_Id, workshop.Creator_Id, workshop.Creation_Timestamp)
+	event.Workshop = &workshop
+	return event
+}
+
+func WorkshopUpdated(workshop models.Workshop) Event {
+	event := newEvent(TypeWorkshopUpdated, workshop.Workshop_Id, workshop.Creator_Id, workshop.Creation_Timestamp)
+	event.Workshop = &workshop
+	return event
+}
+
+// WorkshopStatusChanged announces the status a workshop moved to, as
+// workshop.<status>.
+func WorkshopStatusChanged(workshop models.Workshop) Event {
+	event := newEvent("workshop."+workshop.CurrentStatus(), workshop.Workshop_Id, workshop.Creator_Id, workshop.Creation_Timestamp)
+	event.Workshop = &workshop
+	return event
+}
+
+func WorkshopDeleted(workshop models.Workshop) Event {
+	return newEvent(TypeWorkshopDeleted, workshop.Workshop_Id, workshop.Creator_Id, workshop.Creation_Timestamp)
+}
+
+func AttendeeRegistered(workshopID string, creatorID string, creationTimestamp string, userID string, waitlisted bool) Event {
+	event := newEvent(TypeAttendeeRegistered, workshopID, creatorID, creationTimestamp)
+	event.User_Id = userID
+	event.Waitlisted = waitlisted
+	return event
+}
+
+// AttendeePromoted is the registration of a user who moved off the waitlist.
+func AttendeePromoted(workshopID string, creatorID string, creationTimestamp string, userID string) Event {
+	event := AttendeeRegistered(workshopID, creatorID, creationTimestamp, userID, false)
+	event.Promoted = true
+	return event
+}
+
+func AttendeeWithdrew(workshopID string, creatorID string, creationTimestamp string, userID string, waitlisted bool) Event {
+	event := newEvent(TypeAttendeeWithdrew, workshopID, creatorID, creationTimestamp)
+	event.User_Id = userID
+	event.Waitlisted = waitlisted
+	return event
+}
@@ -0,0 +1,62 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Fanout publishes each event to every one of its publishers, such as the
+// broker and the notices to users. It fails an event if any of them turns it
+// down, so the outbox keeps it, but remembers which publishers took it: when
+// the event is retried, only the others are given it again. That memory does
+// not survive a restart, after which the event goes to all of them again.
+type Fanout struct {
+	publishers []Publisher
+
+	mu sync.Mutex
+	// taken holds, for each event not yet taken by every publisher, the
+	// publishers that have taken it
+	taken map[string]map[int]bool
+}
+
+func NewFanout(publishers ...Publisher) *Fanout {
+	return &Fanout{publishers: publishers, taken: map[string]map[int]bool{}}
+}
+
+func (f *Fanout) Publish(ctx context.Context, events ...Event) error {
+	for _, event := range events {
+		if err := f.publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish gives the event to each publisher that has not taken it yet, even
+// when an earlier one turns it down.
+func (f *Fanout) publish(ctx context.Context, event Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	taken := f.taken[event.Event_Id]
+	if taken == nil {
+		taken = map[int]bool{}
+	}
+	var failed []error
+	for i, publisher := range f.publishers {
+		if taken[i] {
+			continue
+		}
+		if err := publisher.Publish(ctx, event); err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		taken[i] = true
+	}
+	if len(failed) > 0 {
+		f.taken[event.Event_Id] = taken
+		return errors.Join(failed...)
+	}
+	delete(f.taken, event.Event_Id)
+	return nil
+}
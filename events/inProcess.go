@@ -0,0 +1,49 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// InProcess delivers events to subscribers in the same process, as soon as
+// they are published. It is meant for tests and local development.
+type InProcess struct {
+	mu          sync.Mutex
+	published   []Event
+	subscribers []func(Event)
+}
+
+func NewInProcess() *InProcess {
+	return &InProcess{}
+}
+
+// Subscribe calls fn with every event published from now on. Subscribers are
+// called in turn, on the publishing goroutine.
+func (p *InProcess) Subscribe(fn func(Event)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribers = append(p.subscribers, fn)
+}
+
+func (p *InProcess) Publish(ctx context.Context, events ...Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.published = append(p.published, events...)
+	subscribers := append([]func(Event){}, p.subscribers...)
+	p.mu.Unlock()
+	for _, event := range events {
+		for _, subscriber := range subscribers {
+			subscriber(event)
+		}
+	}
+	return nil
+}
+
+// Events returns every event published so far, oldest first.
+func (p *InProcess) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event{}, p.published...)
+}
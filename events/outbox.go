@@ -0,0 +1,88 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"workshop/metrics"
+)
+
+const (
+	// relayInterval is how often the relay retries events the broker did
+	// not take, and picks up events recorded by other instances
+	relayInterval = 5 * time.Second
+	// relayBatchSize is how many events are read from the outbox at a time
+	relayBatchSize = 100
+)
+
+// OutboxStore keeps events until the broker has taken them. The workshop
+// store records events in it in the same atomic step as the change they
+// describe, so a change is never made without its events.
+type OutboxStore interface {
+	// Recorded receives a value when events have been recorded since it was
+	// last read, so they can be relayed without waiting for the next retry.
+	Recorded() <-chan struct{}
+	// Pending returns up to limit recorded events, oldest first.
+	Pending(ctx context.Context, limit int) ([]Event, error)
+	// Remove forgets a recorded event.
+	Remove(ctx context.Context, event Event) error
+}
+
+// Outbox relays the events recorded in a store to the broker, so events
+// recorded while the broker is down are sent once it is back rather than
+// lost. Events are relayed in the order they were recorded, and at least
+// once: an event may be sent again if the broker took it but removing it
+// from the store failed.
+type Outbox struct {
+	store  OutboxStore
+	broker Publisher
+	// relaying stops two relays sending the same events side by side
+	relaying sync.Mutex
+}
+
+func NewOutbox(store OutboxStore, broker Publisher) *Outbox {
+	return &Outbox{store: store, broker: broker}
+}
+
+// Run relays recorded events to the broker until ctx is done. Events the
+// broker turns down are retried every relayInterval.
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+	for {
+		if err := o.Flush(ctx); err != nil && ctx.Err() == nil {
+			metrics.EventRelayErrors.Inc()
+			slog.Warn("could not relay events", "error", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.store.Recorded():
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush relays every recorded event to the broker. It stops at the first
+// event the broker does not take, so later events do not overtake it.
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.relaying.Lock()
+	defer o.relaying.Unlock()
+	for {
+		pending, err := o.store.Pending(ctx, relayBatchSize)
+		if err != nil || len(pending) == 0 {
+			return err
+		}
+		for _, event := range pending {
+			if err := o.broker.Publish(ctx, event); err != nil {
+				return err
+			}
+			metrics.EventsRelayed.WithLabelValues(event.Type).Inc()
+			if err := o.store.Remove(ctx, event); err != nil {
+				return err
+			}
+		}
+	}
+}
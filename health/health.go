@@ -0,0 +1,106 @@
+// Package health checks whether the dependencies the service needs to serve
+// traffic are reachable.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// checkTimeout bounds each check, so one hanging dependency cannot hold up
+// the readiness probe.
+const checkTimeout = 2 * time.Second
+
+// Check is one dependency the service cannot work without, such as a table.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// DependencyStatus is the outcome of one Check. It is served to anyone who
+// asks, so why a dependency is unavailable is only logged: AWS errors name
+// the account, role and table.
+type DependencyStatus struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Report is the outcome of every Check. Status is StatusOK only if every
+// dependency is.
+type Report struct {
+	Status       string             `json:"status"`
+	CheckedAt    time.Time          `json:"checked_at"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// Checker runs its checks at most once every ttl and hands out the cached
+// report in between, so frequent probes do not turn into a stream of calls
+// to AWS.
+type Checker struct {
+	checks []Check
+	ttl    time.Duration
+
+	mu     sync.Mutex
+	report Report
+}
+
+func NewChecker(ttl time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, ttl: ttl}
+}
+
+// Report returns the latest report, running the checks again if it is older
+// than the ttl. Callers arriving while the checks run wait for their result
+// rather than starting checks of their own.
+func (c *Checker) Report(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.report.CheckedAt.IsZero() && time.Since(c.report.CheckedAt) < c.ttl {
+		return c.report
+	}
+
+	// the probe's own deadline does not cut the checks short, as others share
+	// their result
+	ctx = context.WithoutCancel(ctx)
+	report := Report{Status: StatusOK, CheckedAt: time.Now(), Dependencies: make([]DependencyStatus, len(c.checks))}
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Dependencies[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+	for _, dependency := range report.Dependencies {
+		if dependency.Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	c.report = report
+	return report
+}
+
+func run(ctx context.Context, check Check) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	start := time.Now()
+	err := check.Run(ctx)
+	status := DependencyStatus{
+		Name:      check.Name,
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = StatusUnavailable
+		slog.Warn("dependency unavailable", "dependency", check.Name, "error", err.Error())
+	}
+	return status
+}
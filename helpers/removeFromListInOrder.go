@@ -0,0 +1,14 @@
+package helpers
+
+import (
+	"errors"
+)
+
+// RemoveFromListInOrder removes the element at index i while keeping the
+// remaining elements in their original order, unlike RemoveFromList.
+func RemoveFromListInOrder(s []string, i int) ([]string, error) {
+	if i < 0 || i > len(s)-1 {
+		return []string{}, errors.New("Index provided is out of bounds!")
+	}
+	return append(append([]string{}, s[:i]...), s[i+1:]...), nil
+}
@@ -0,0 +1,97 @@
+// Package idempotency remembers the responses to requests sent with an
+// Idempotency-Key header, so a client that retries one, not knowing whether
+// it went through, gets the first response again instead of a second change.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// lockTimeout is how long a request may hold its key before a retry may
+// take it over, in case it never finishes, e.g. because the process died. It
+// outlasts the server's write timeout.
+const lockTimeout = time.Minute
+
+// Record is what is kept for a key.
+type Record struct {
+	Key string
+	// Fingerprint tells the request the key was first sent with from another
+	// one reusing it
+	Fingerprint string
+	// Done is set once the request has finished, and Response is what it
+	// answered; until then a request is still working on it
+	Done     bool
+	Response Response
+	// Expires_At is when the record is forgotten
+	Expires_At time.Time
+}
+
+// Response is a response as it is replayed.
+type Response struct {
+	Status int
+	Header map[string]string
+	Body   []byte
+}
+
+// Store keeps records until they expire. Records past their Expires_At must
+// be treated as if they were gone.
+type Store interface {
+	// Claim saves record unless a record with its key is already there, in
+	// which case it returns that record instead and saves nothing.
+	Claim(ctx context.Context, record Record) (*Record, error)
+	// Save overwrites the record with its key.
+	Save(ctx context.Context, record Record) error
+	// Release forgets the record with key.
+	Release(ctx context.Context, key string) error
+}
+
+// Keys hands out keys and remembers responses for ttl.
+type Keys struct {
+	store Store
+	ttl   time.Duration
+}
+
+func New(store Store, ttl time.Duration) *Keys {
+	return &Keys{store: store, ttl: ttl}
+}
+
+// Begin claims key for a request with fingerprint. It returns nil if the
+// request is the first with the key, so it should go ahead and Finish or
+// Abandon it; otherwise it returns the record of the first request.
+func (k *Keys) Begin(ctx context.Context, key string, fingerprint string) (*Record, error) {
+	return k.store.Claim(ctx, Record{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Expires_At:  time.Now().Add(lockTimeout),
+	})
+}
+
+// Finish remembers the response of the request that claimed key.
+func (k *Keys) Finish(ctx context.Context, key string, fingerprint string, response Response) error {
+	return k.store.Save(ctx, Record{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Done:        true,
+		Response:    response,
+		Expires_At:  time.Now().Add(k.ttl),
+	})
+}
+
+// Abandon gives key up, so a retry can try again.
+func (k *Keys) Abandon(ctx context.Context, key string) error {
+	return k.store.Release(ctx, key)
+}
+
+// Fingerprint identifies a request by its method, path and body.
+func Fingerprint(method string, path string, body []byte) string {
+	hash := sha256.New()
+	for _, part := range [][]byte{[]byte(method), []byte(path), body} {
+		hash.Write(part)
+		// parts are separated so they cannot run into each other
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
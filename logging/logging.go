@@ -0,0 +1,75 @@
+// Package logging sets up the service's structured logs. Records are written
+// as JSON, one per line, and user IDs are pseudonymised on the way out.
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// UserIDKey and CreatorIDKey are the attribute keys for user IDs. Values
+// logged under them are never written as they are.
+const (
+	UserIDKey    = "user_id"
+	CreatorIDKey = "creator_id"
+)
+
+// pseudonymKey is drawn afresh by every process, so a pseudonym ties log
+// lines of one process together without leading back to the user.
+var pseudonymKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// New returns a logger writing JSON records at level and above to w.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}))
+}
+
+// UserID is the attribute to log a user ID with.
+func UserID(id string) slog.Attr {
+	return slog.String(UserIDKey, id)
+}
+
+// CreatorID is the attribute to log a workshop's Creator_Id with.
+func CreatorID(id string) slog.Attr {
+	return slog.String(CreatorIDKey, id)
+}
+
+// Pseudonym stands in for a user ID in the logs.
+func Pseudonym(id string) string {
+	mac := hmac.New(sha256.New, pseudonymKey)
+	mac.Write([]byte(id))
+	return "user-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// redact replaces the value of every user ID attribute with its pseudonym,
+// whether it was logged as user_id or as the models' User_Id. Creators are
+// users too.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if strings.EqualFold(a.Key, UserIDKey) || strings.EqualFold(a.Key, CreatorIDKey) {
+		return slog.String(a.Key, Pseudonym(a.Value.String()))
+	}
+	return a
+}
+
+// ParseLevel turns a configured level name into a slog level; anything
+// unknown is info.
+func ParseLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
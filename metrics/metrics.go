@@ -0,0 +1,160 @@
+// Package metrics defines the Prometheus metrics the service exposes on
+// /metrics.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "workshop"
+
+// Registry holds every metric below, together with the Go runtime and
+// process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts requests by the route template they matched, so
+	// /workshop/id/{id} is one series however many workshops there are.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	DynamoDBRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dynamodb_request_duration_seconds",
+		Help:      "Time taken by DynamoDB calls including retries, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+	DynamoDBErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dynamodb_errors_total",
+		Help:      "DynamoDB calls that failed, by operation and AWS error code.",
+	}, []string{"operation", "code"})
+
+	// Registrations counts successful registrations by whether the user got
+	// a seat or a place on the waitlist.
+	Registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Successful registrations, by outcome (attendee or waitlisted).",
+	}, []string{"outcome"})
+	Withdrawals = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "withdrawals_total",
+		Help:      "Attendees who withdrew from a workshop.",
+	})
+	// RegistrationsRejectedFull counts registrations turned away because the
+	// workshop had no vacancy and the user declined the waitlist.
+	RegistrationsRejectedFull = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_rejected_full_total",
+		Help:      "Registrations rejected because the workshop was full.",
+	})
+	WorkshopsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "workshops_created_total",
+		Help:      "Workshops created.",
+	})
+
+	// EventsRelayed counts domain events the broker has taken from the
+	// outbox, by event type.
+	EventsRelayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_relayed_total",
+		Help:      "Domain events relayed from the outbox to the broker, by type.",
+	}, []string{"type"})
+	EventRelayErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_relay_errors_total",
+		Help:      "Attempts to relay the outbox to the broker that failed.",
+	})
+
+	// RateLimited counts requests turned away with a 429, by route group.
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected for exceeding their client's rate limit, by route group.",
+	}, []string{"group"})
+	RateLimitClients = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_clients",
+		Help:      "Clients with a rate limit bucket in memory, by route group.",
+	}, []string{"group"})
+
+	NotificationsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_sent_total",
+		Help:      "Notices sent to users about their workshops, by type.",
+	}, []string{"type"})
+	NotificationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_errors_total",
+		Help:      "Notices given up on after every attempt to send them failed, by type.",
+	}, []string{"type"})
+)
+
+const (
+	OutcomeAttendee   = "attendee"
+	OutcomeWaitlisted = "waitlisted"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		DynamoDBRequestDuration,
+		DynamoDBErrors,
+		Registrations,
+		Withdrawals,
+		RegistrationsRejectedFull,
+		WorkshopsCreated,
+		EventsRelayed,
+		EventRelayErrors,
+		RateLimited,
+		RateLimitClients,
+		NotificationsSent,
+		NotificationErrors,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// DynamoDBHandler records the duration and outcome of each DynamoDB call once
+// it has completed. Add it to a client's Complete handlers.
+var DynamoDBHandler = request.NamedHandler{
+	Name: "workshop.metrics.DynamoDB",
+	Fn: func(r *request.Request) {
+		operation := r.Operation.Name
+		DynamoDBRequestDuration.WithLabelValues(operation).Observe(time.Since(r.Time).Seconds())
+		if r.Error == nil {
+			return
+		}
+		code := "unknown"
+		var awsErr awserr.Error
+		if errors.As(r.Error, &awsErr) {
+			code = awsErr.Code()
+		}
+		DynamoDBErrors.WithLabelValues(operation, code).Inc()
+	},
+}
@@ -0,0 +1,16 @@
+package models
+
+// FieldError reports a request field that failed validation.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// FieldErrors lets the error be reported field by field.
+func (e *FieldError) FieldErrors() map[string]string {
+	return map[string]string{e.Field: e.Message}
+}
@@ -0,0 +1,18 @@
+package models
+
+const (
+	RegistrationStatusRegistered = "registered"
+	RegistrationStatusWaitlisted = "waitlisted"
+)
+
+// Registration records that a user holds a seat on, or is waiting for, a
+// workshop. It mirrors the workshop's Attendees and Waitlist so a user's
+// workshops can be looked up without scanning every workshop.
+type Registration struct {
+	User_Id                string
+	Workshop_Id            string
+	Creator_Id             string
+	Creation_Timestamp     string
+	Status                 string
+	Registration_Timestamp string
+}
@@ -0,0 +1,52 @@
+package models
+
+// The states a workshop moves through. Workshops start out as drafts or
+// published, and end up cancelled or completed.
+const (
+	StatusDraft              = "draft"
+	StatusPublished          = "published"
+	StatusRegistrationClosed = "registration_closed"
+	StatusCancelled          = "cancelled"
+	StatusCompleted          = "completed"
+)
+
+// Statuses lists every status, in lifecycle order.
+var Statuses = []string{StatusDraft, StatusPublished, StatusRegistrationClosed, StatusCancelled, StatusCompleted}
+
+// transitions lists the statuses each status may move to. Cancelled and
+// completed workshops are final.
+var transitions = map[string][]string{
+	StatusDraft:              {StatusPublished, StatusCancelled},
+	StatusPublished:          {StatusRegistrationClosed, StatusCancelled, StatusCompleted},
+	StatusRegistrationClosed: {StatusPublished, StatusCancelled, StatusCompleted},
+}
+
+// IsStatus reports whether status is one of Statuses.
+func IsStatus(status string) bool {
+	for _, known := range Statuses {
+		if status == known {
+			return true
+		}
+	}
+	return false
+}
+
+// CanTransition reports whether a workshop may move from one status to
+// another.
+func CanTransition(from string, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentStatus is the workshop's Status. Workshops stored before they had
+// one were open for registration, so they are published.
+func (w Workshop) CurrentStatus() string {
+	if w.Status == "" {
+		return StatusPublished
+	}
+	return w.Status
+}
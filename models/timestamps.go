@@ -0,0 +1,171 @@
+package models
+
+import (
+	"time"
+	// bundled so Time_Zone works on hosts without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// TimestampLayout is the layout every timestamp is stored in: RFC 3339 in UTC
+// with millisecond precision, so stored values sort as strings.
+const TimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// LegacyTimestampLayout is the layout timestamps were stored in before they
+// moved to UTC. Legacy timestamps are Singapore time (UTC+8).
+const LegacyTimestampLayout = "2006-01-02-15:04:05.000"
+
+// localTimestampLayout is an RFC 3339 timestamp without its offset. Clients
+// may send one to mean wall clock time in the workshop's Time_Zone.
+const localTimestampLayout = "2006-01-02T15:04:05"
+
+const (
+	// DefaultTimeZone is the Time_Zone of workshops created without one
+	DefaultTimeZone = "UTC"
+	// LegacyTimeZone is the Time_Zone given to workshops migrated from the
+	// legacy layout
+	LegacyTimeZone = "Asia/Singapore"
+)
+
+var legacyTimestampZone = time.FixedZone("SGT", 8*60*60)
+
+// ParseTimestamp parses a stored timestamp. Legacy timestamps are still
+// understood so workshops keep working until they have been migrated.
+func ParseTimestamp(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(LegacyTimestampLayout, value, legacyTimestampZone)
+}
+
+// ParseTimestampIn parses a timestamp sent by a client. Besides the stored
+// forms it accepts a timestamp without an offset, read in loc.
+func ParseTimestampIn(value string, loc *time.Location) (time.Time, error) {
+	if t, err := ParseTimestamp(value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(localTimestampLayout, value, loc)
+}
+
+// IsLegacyTimestamp reports whether value is in the legacy layout.
+func IsLegacyTimestamp(value string) bool {
+	_, err := time.Parse(LegacyTimestampLayout, value)
+	return err == nil
+}
+
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(TimestampLayout)
+}
+
+// LoadTimeZone loads an IANA time zone name, failing with a *FieldError.
+// An empty name is DefaultTimeZone.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		name = DefaultTimeZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, &FieldError{"Time_Zone", "Time_Zone must be an IANA time zone name such as Asia/Singapore"}
+	}
+	return loc, nil
+}
+
+// TimeZone is the location named by Time_Zone.
+func (w Workshop) TimeZone() (*time.Location, error) {
+	return LoadTimeZone(w.Time_Zone)
+}
+
+// RegistrationDeadline parses Registration_Deadline. ok is false when the
+// workshop has no deadline.
+func (w Workshop) RegistrationDeadline() (deadline time.Time, ok bool, err error) {
+	if w.Registration_Deadline == "" {
+		return time.Time{}, false, nil
+	}
+	deadline, err = ParseTimestamp(w.Registration_Deadline)
+	if err != nil {
+		return time.Time{}, false, &FieldError{"Registration_Deadline", "Registration_Deadline must be an RFC 3339 timestamp"}
+	}
+	return deadline, true, nil
+}
+
+// StartTime parses Start_Timestamp. ok is false when the workshop has no
+// start time.
+func (w Workshop) StartTime() (start time.Time, ok bool, err error) {
+	if w.Start_Timestamp == "" {
+		return time.Time{}, false, nil
+	}
+	start, err = ParseTimestamp(w.Start_Timestamp)
+	if err != nil {
+		return time.Time{}, false, &FieldError{"Start_Timestamp", "Start_Timestamp must be an RFC 3339 timestamp"}
+	}
+	return start, true, nil
+}
+
+// NormalizeSchedule rewrites Registration_Deadline and Start_Timestamp as
+// sent by a client into the stored layout. Times without an offset are read
+// in the workshop's Time_Zone. Failures are returned as a *FieldError.
+func (w *Workshop) NormalizeSchedule() error {
+	loc, err := w.TimeZone()
+	if err != nil {
+		return err
+	}
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"Registration_Deadline", &w.Registration_Deadline},
+		{"Start_Timestamp", &w.Start_Timestamp},
+	}
+	for _, field := range fields {
+		if *field.value == "" {
+			continue
+		}
+		t, err := ParseTimestampIn(*field.value, loc)
+		if err != nil {
+			return &FieldError{field.name, field.name + " must be an RFC 3339 timestamp"}
+		}
+		*field.value = FormatTimestamp(t)
+	}
+	return nil
+}
+
+// InTimeZone returns the workshop with its schedule rendered in loc.
+// Creation_Timestamp is part of the workshop's key, so it is left as stored.
+func (w Workshop) InTimeZone(loc *time.Location) Workshop {
+	render := func(value string) string {
+		t, err := ParseTimestamp(value)
+		if err != nil {
+			return value
+		}
+		return t.In(loc).Format(TimestampLayout)
+	}
+	w.Registration_Deadline = render(w.Registration_Deadline)
+	w.Start_Timestamp = render(w.Start_Timestamp)
+	return w
+}
+
+// ValidateSchedule checks that both times are present, that registration
+// closes before the workshop starts and that the start is still ahead of now.
+// Failures are returned as a *FieldError.
+func (w Workshop) ValidateSchedule(now time.Time) error {
+	deadline, hasDeadline, err := w.RegistrationDeadline()
+	if err != nil {
+		return err
+	}
+	start, hasStart, err := w.StartTime()
+	if err != nil {
+		return err
+	}
+	if !hasDeadline {
+		return &FieldError{"Registration_Deadline", "Missing Registration_Deadline"}
+	}
+	if !hasStart {
+		return &FieldError{"Start_Timestamp", "Missing Start_Timestamp"}
+	}
+	if !deadline.Before(start) {
+		return &FieldError{"Registration_Deadline", "Registration_Deadline must be before Start_Timestamp"}
+	}
+	if !start.After(now) {
+		return &FieldError{"Start_Timestamp", "Start_Timestamp must be in the future"}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package models
 
 type Workshop struct {
+	// Workshop_Id is a server-generated UUID, stable for the life of the workshop
+	Workshop_Id           string
     Creator_Id  string
 	Creation_Timestamp string
 	Title  string
@@ -8,6 +10,16 @@ type Workshop struct {
 	Location  string
 	Vacancies  int64
 	Attendees  []string
-	Registration_Deadline string
-	Start_Timestamp string
-}
\ No newline at end of file
+	Waitlist              []string // in the order users joined
+	Registration_Deadline string   // stored as UTC RFC 3339
+	Start_Timestamp       string   // stored as UTC RFC 3339
+	Time_Zone             string   // IANA zone the workshop takes place in
+	// Status is one of the Status constants, changed only by the transition
+	// routes. Workshops stored before it existed have none; see CurrentStatus.
+	Status string
+	// Cancellation_Reason is what the workshop's attendees were told when it
+	// was cancelled
+	Cancellation_Reason string
+	// Version is bumped on every write and guards concurrent updates
+	Version int64
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 5000
+	MaxLocationLength    = 200
+	MaxVacancies         = 10000
+	MaxReasonLength      = 500
+	maxTimestampLength   = 64
+	maxTimeZoneLength    = 64
+)
+
+// WorkshopPatch holds the fields a PATCH may change. Nil fields are left as
+// they are.
+type WorkshopPatch struct {
+	Title       *string
+	Description *string
+	Location    *string
+	// Vacancies is the number of seats left, as a workshop reports it. The
+	// current attendees keep their seats whatever it is set to.
+	Vacancies             *int64
+	Registration_Deadline *string
+	Start_Timestamp       *string
+	Time_Zone             *string
+}
+
+// ParseWorkshopPatch decodes a PATCH body field by field. Every problem is
+// reported, keyed by field name, so clients can fix them all in one go.
+func ParseWorkshopPatch(body map[string]json.RawMessage) (WorkshopPatch, map[string]string) {
+	var patch WorkshopPatch
+	problems := map[string]string{}
+
+	text := func(field string, minLength int, maxLength int) *string {
+		var value string
+		if err := json.Unmarshal(body[field], &value); err != nil {
+			problems[field] = field + " must be a string"
+			return nil
+		}
+		length := utf8.RuneCountInString(strings.TrimSpace(value))
+		if length < minLength || length > maxLength {
+			problems[field] = fmt.Sprintf("%s must be between %d and %d characters", field, minLength, maxLength)
+			return nil
+		}
+		return &value
+	}
+
+	for field := range body {
+		switch field {
+		case "Title":
+			patch.Title = text(field, 1, MaxTitleLength)
+		case "Description":
+			patch.Description = text(field, 0, MaxDescriptionLength)
+		case "Location":
+			patch.Location = text(field, 1, MaxLocationLength)
+		case "Registration_Deadline":
+			patch.Registration_Deadline = text(field, 1, maxTimestampLength)
+		case "Start_Timestamp":
+			patch.Start_Timestamp = text(field, 1, maxTimestampLength)
+		case "Time_Zone":
+			patch.Time_Zone = text(field, 1, maxTimeZoneLength)
+			if patch.Time_Zone != nil {
+				if _, err := LoadTimeZone(*patch.Time_Zone); err != nil {
+					problems[field] = err.Error()
+					patch.Time_Zone = nil
+				}
+			}
+		case "Vacancies":
+			var value float64
+			if err := json.Unmarshal(body[field], &value); err != nil || value != math.Trunc(value) {
+				problems[field] = "Vacancies must be a whole number"
+				continue
+			}
+			if value < 0 || value > MaxVacancies {
+				problems[field] = fmt.Sprintf("Vacancies must be between 0 and %d", MaxVacancies)
+				continue
+			}
+			vacancies := int64(value)
+			patch.Vacancies = &vacancies
+		case "Status":
+			problems[field] = "Status is changed through the publish, close, cancel and complete routes"
+		case "Cancellation_Reason":
+			problems[field] = "Cancellation_Reason is given when cancelling the workshop"
+		default:
+			problems[field] = "You may not patch this field"
+		}
+	}
+	return patch, problems
+}
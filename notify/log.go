@@ -0,0 +1,18 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+
+	"workshop/logging"
+)
+
+// Log only logs each notice, so notices can be seen in local development
+// without a mail server. User IDs are logged by their pseudonyms, as always.
+type Log struct{}
+
+func (Log) Notify(ctx context.Context, notice Notice) error {
+	slog.InfoContext(ctx, "notice", "type", notice.Type, "workshop_id", notice.Workshop_Id,
+		logging.UserID(notice.User_Id), "waitlisted", notice.Waitlisted, "reason", notice.Reason)
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package notify tells users about changes to the workshops they signed up
+// for, such as a cancellation, by email, webhook or just the log.
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"workshop/config"
+	"workshop/events"
+	"workshop/logging"
+	"workshop/metrics"
+	"workshop/models"
+)
+
+// Notice tells one user about a change to a workshop.
+type Notice struct {
+	// Type is the event type of the change, such as workshop.cancelled
+	Type    string
+	User_Id string
+	// Waitlisted is set when the user was on the waitlist rather than an
+	// attendee
+	Waitlisted         bool `json:",omitempty"`
+	Workshop_Id        string
+	Creator_Id         string
+	Creation_Timestamp string
+	Title              string
+	Start_Timestamp    string
+	Time_Zone          string
+	// Reason is what the creator gave for the change
+	Reason string `json:",omitempty"`
+}
+
+// Notifier sends notices.
+type Notifier interface {
+	Notify(ctx context.Context, notice Notice) error
+}
+
+// New returns the notifier cfg asks for.
+func New(cfg config.Notifications) Notifier {
+	switch cfg.Notifier {
+	case config.NotifierSMTP:
+		return NewSMTP(cfg)
+	case config.NotifierWebhook:
+		return NewWebhook(cfg.WebhookURL, cfg.WebhookSecret)
+	}
+	return Log{}
+}
+
+// WorkshopCancelled is a notice to each attendee of a cancelled workshop, and
+// to everyone on its waitlist.
+func WorkshopCancelled(workshop models.Workshop) []Notice {
+	notices := []Notice{}
+	notice := func(userID string, waitlisted bool) Notice {
+		return Notice{
+			Type:               events.TypeWorkshopCancelled,
+			User_Id:            userID,
+			Waitlisted:         waitlisted,
+			Workshop_Id:        workshop.Workshop_Id,
+			Creator_Id:         workshop.Creator_Id,
+			Creation_Timestamp: workshop.Creation_Timestamp,
+			Title:              workshop.Title,
+			Start_Timestamp:    workshop.Start_Timestamp,
+			Time_Zone:          workshop.Time_Zone,
+			Reason:             workshop.Cancellation_Reason,
+		}
+	}
+	for _, userID := range workshop.Attendees {
+		notices = append(notices, notice(userID, false))
+	}
+	for _, userID := range workshop.Waitlist {
+		notices = append(notices, notice(userID, true))
+	}
+	return notices
+}
+
+// noticesFor returns the notices an event calls for. Only the users of a
+// cancelled workshop are told anything so far.
+func noticesFor(event events.Event) []Notice {
+	if event.Type == events.TypeWorkshopCancelled && event.Workshop != nil {
+		return WorkshopCancelled(*event.Workshop)
+	}
+	return nil
+}
+
+// maxAttempts is how often a notice is tried before it is given up on.
+const maxAttempts = 5
+
+// noticeKey names one notice of one event.
+type noticeKey struct {
+	eventID string
+	userID  string
+}
+
+// Dispatcher sends the notices the events relayed from the outbox call for,
+// so a notice is as durable as the change it is about. It is an
+// events.Publisher: an event whose notices could not all be sent is turned
+// down, so the relay tries it again later, and then only the notices not yet
+// sent are retried. A notice that still fails after maxAttempts is logged,
+// counted and given up on, so it does not hold up the events behind it.
+type Dispatcher struct {
+	notifier Notifier
+	// timeout bounds sending each notice
+	timeout time.Duration
+
+	mu sync.Mutex
+	// sent and attempts track the notices of the events not fully
+	// dispatched yet. Neither survives a restart, after which an event's
+	// notices are all sent again.
+	sent     map[noticeKey]bool
+	attempts map[noticeKey]int
+}
+
+func NewDispatcher(notifier Notifier, timeout time.Duration) *Dispatcher {
+	return &Dispatcher{notifier: notifier, timeout: timeout, sent: map[noticeKey]bool{}, attempts: map[noticeKey]int{}}
+}
+
+// Publish sends the notices the events call for. It fails if any of them
+// could not be sent and may still be retried.
+func (d *Dispatcher) Publish(ctx context.Context, relayed ...events.Event) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, event := range relayed {
+		if err := d.dispatch(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatch tries every notice of the event that is not yet sent or given up
+// on, and forgets them all once none is left.
+func (d *Dispatcher) dispatch(ctx context.Context, event events.Event) error {
+	notices := noticesFor(event)
+	var failed error
+	for _, notice := range notices {
+		key := noticeKey{event.Event_Id, notice.User_Id}
+		if d.sent[key] {
+			continue
+		}
+		err := d.deliver(ctx, notice)
+		if err == nil {
+			metrics.NotificationsSent.WithLabelValues(notice.Type).Inc()
+			d.sent[key] = true
+			continue
+		}
+		// the relay stopping is no fault of the notice's
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		d.attempts[key] += 1
+		if d.attempts[key] < maxAttempts {
+			slog.Warn("could not send a notice, will retry", "type", notice.Type, "workshop_id", notice.Workshop_Id,
+				logging.UserID(notice.User_Id), "attempt", d.attempts[key], "error", err.Error())
+			failed = err
+			continue
+		}
+		metrics.NotificationErrors.WithLabelValues(notice.Type).Inc()
+		slog.Error("could not send a notice, giving up", "type", notice.Type, "workshop_id", notice.Workshop_Id,
+			logging.UserID(notice.User_Id), "attempts", d.attempts[key], "error", err.Error())
+		d.sent[key] = true
+	}
+	if failed != nil {
+		return failed
+	}
+	for _, notice := range notices {
+		key := noticeKey{event.Event_Id, notice.User_Id}
+		delete(d.sent, key)
+		delete(d.attempts, key)
+	}
+	return nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, notice Notice) error {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	return d.notifier.Notify(ctx, notice)
+}
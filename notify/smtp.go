@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"workshop/config"
+)
+
+// SMTP emails each notice. Locally it can send to a stand-in such as
+// Mailpit, which catches the mail instead of delivering it.
+type SMTP struct {
+	addr string
+	host string
+	from *mail.Address
+	auth smtp.Auth
+	// domain makes addresses of the user IDs that are not addresses already
+	domain string
+}
+
+// NewSMTP returns a notifier sending through the server cfg names. The
+// configuration has already checked the addresses.
+func NewSMTP(cfg config.Notifications) *SMTP {
+	host, _, _ := net.SplitHostPort(cfg.SMTPAddr)
+	from, _ := mail.ParseAddress(cfg.SMTPFrom)
+	s := &SMTP{addr: cfg.SMTPAddr, host: host, from: from, domain: cfg.SMTPRecipientDomain}
+	if cfg.SMTPUsername != "" {
+		// PlainAuth refuses to send the password unencrypted, except to
+		// localhost
+		s.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, host)
+	}
+	return s
+}
+
+func (s *SMTP) Notify(ctx context.Context, notice Notice) error {
+	to, err := s.address(notice.User_Id)
+	if err != nil {
+		return err
+	}
+	message, err := s.message(to, notice)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.auth != nil {
+		if err := c.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// address is where the user's mail goes: their user ID, if it is an email
+// address, or else the user ID at the recipient domain. The user ID is left
+// out of the errors, as it is only ever logged by its pseudonym.
+func (s *SMTP) address(userID string) (*mail.Address, error) {
+	address := userID
+	if !strings.Contains(userID, "@") {
+		if s.domain == "" {
+			return nil, errors.New("the user ID is not an email address, and WORKSHOP_SMTP_RECIPIENT_DOMAIN is not set")
+		}
+		address = userID + "@" + s.domain
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address {
+		return nil, errors.New("the user ID does not make a valid email address")
+	}
+	return parsed, nil
+}
+
+// message is the email for a cancellation notice. The title is the creator's
+// own words, so it is kept to one line and goes into the subject encoded.
+func (s *SMTP) message(to *mail.Address, notice Notice) ([]byte, error) {
+	title := strings.Join(strings.Fields(notice.Title), " ")
+	if title == "" {
+		title = "A workshop"
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s has been cancelled.\n", title)
+	if notice.Start_Timestamp != "" {
+		fmt.Fprintf(&text, "\nIt was due to start at %s.\n", notice.Start_Timestamp)
+	}
+	if notice.Reason != "" {
+		fmt.Fprintf(&text, "\nThe reason given was: %s\n", notice.Reason)
+	}
+	if notice.Waitlisted {
+		text.WriteString("\nYou were on its waitlist.\n")
+	}
+
+	var message bytes.Buffer
+	headers := []struct{ name, value string }{
+		{"From", s.from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", "Cancelled: "+title)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&message, "%s: %s\r\n", header.name, header.value)
+	}
+	message.WriteString("\r\n")
+	body := quotedprintable.NewWriter(&message)
+	if _, err := body.Write([]byte(text.String())); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook's body, keyed with
+// the webhook secret, as sha256=<hex>.
+const SignatureHeader = "X-Workshop-Signature"
+
+// Webhook posts each notice as JSON to a URL, which is left to reach the
+// user. Any answer but a 2xx is a failure.
+type Webhook struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhook returns a notifier posting to url. Bodies are signed when
+// secret is not empty.
+func NewWebhook(url string, secret string) *Webhook {
+	return &Webhook{url: url, secret: secret, client: &http.Client{}}
+}
+
+func (h *Webhook) Notify(ctx context.Context, notice Notice) error {
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		// the URL may hold a token, so it is left out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("posting to the webhook: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("the webhook answered %d", res.StatusCode)
+	}
+	return nil
+}
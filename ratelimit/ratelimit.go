@@ -0,0 +1,153 @@
+// Package ratelimit keeps a token bucket for each client and group of
+// routes, so no single client can hammer the service or DynamoDB.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"workshop/config"
+	"workshop/metrics"
+
+	"golang.org/x/time/rate"
+)
+
+// The groups routes are limited in.
+const (
+	GroupReads        = "reads"
+	GroupWrites       = "writes"
+	GroupRegistration = "registration"
+)
+
+// sweepInterval is how often buckets of clients gone quiet are dropped.
+const sweepInterval = time.Minute
+
+// Limits holds the buckets of every group.
+type Limits struct {
+	groups    map[string]*buckets
+	proxyHops int
+}
+
+// New returns limits as cfg configures them.
+func New(cfg config.RateLimits) *Limits {
+	l := &Limits{groups: map[string]*buckets{}, proxyHops: cfg.ProxyHops}
+	for group, limit := range map[string]config.Limit{
+		GroupReads:        cfg.Reads,
+		GroupWrites:       cfg.Writes,
+		GroupRegistration: cfg.Registration,
+	} {
+		if limit.Rate > 0 {
+			l.groups[group] = newBuckets(group, limit)
+		}
+	}
+	return l
+}
+
+// Allow takes a token from client's bucket in group. When there is none, it
+// returns false and how long until there will be.
+func (l *Limits) Allow(group string, client string) (bool, time.Duration) {
+	b, ok := l.groups[group]
+	if !ok {
+		return true, 0
+	}
+	return b.allow(client, time.Now())
+}
+
+// ClientIP is the address a request came from, looking past the trusted
+// proxies in X-Forwarded-For.
+func (l *Limits) ClientIP(r *http.Request) string {
+	if l.proxyHops > 0 {
+		var forwarded []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(header, ",") {
+				forwarded = append(forwarded, strings.TrimSpace(hop))
+			}
+		}
+		// each proxy appends the address it saw, so the outermost one's is
+		// proxyHops from the end
+		if len(forwarded) >= l.proxyHops {
+			if ip := net.ParseIP(forwarded[len(forwarded)-l.proxyHops]); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// buckets are the token buckets of one group, by client.
+type buckets struct {
+	group string
+	limit rate.Limit
+	burst int
+	// idle is how long a bucket takes to fill up again, after which it is
+	// no different from a new one and can be dropped
+	idle time.Duration
+
+	mu        sync.Mutex
+	clients   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newBuckets(group string, limit config.Limit) *buckets {
+	return &buckets{
+		group:     group,
+		limit:     rate.Limit(limit.Rate),
+		burst:     limit.Burst,
+		idle:      time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second)),
+		clients:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (b *buckets) allow(client string, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Sub(b.lastSweep) >= sweepInterval {
+		b.sweep(now)
+	}
+	c, ok := b.clients[client]
+	if !ok {
+		c = &bucket{limiter: rate.NewLimiter(b.limit, b.burst)}
+		b.clients[client] = c
+		metrics.RateLimitClients.WithLabelValues(b.group).Set(float64(len(b.clients)))
+	}
+	c.lastSeen = now
+	reservation := c.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		// the request is turned away, so it does not get to spend the token
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// sweep drops the buckets of clients that have been quiet long enough for
+// them to fill up.
+func (b *buckets) sweep(now time.Time) {
+	for client, c := range b.clients {
+		if now.Sub(c.lastSeen) >= b.idle {
+			delete(b.clients, client)
+		}
+	}
+	b.lastSweep = now
+	metrics.RateLimitClients.WithLabelValues(b.group).Set(float64(len(b.clients)))
+}
+
+// RetryAfter is the Retry-After header for a wait, in whole seconds rounded
+// up, as a client that retries sooner would only be turned away again.
+func RetryAfter(wait time.Duration) int {
+	return int(math.Max(1, math.Ceil(wait.Seconds())))
+}
@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"workshop/apperrors"
+	"workshop/auth"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	errUnauthenticated = apperrors.New(apperrors.Unauthenticated, "unauthenticated", "A bearer token is required.")
+	errInvalidToken    = apperrors.New(apperrors.Unauthenticated, "invalid_token", "The bearer token is invalid or has expired.")
+	errForbidden       = apperrors.New(apperrors.Forbidden, "forbidden", "You may not act for this user or workshop.")
+	errAdminOnly       = apperrors.New(apperrors.Forbidden, "admin_only", "Only admins may delete workshops; cancel it instead.")
+)
+
+// bearerChallenge is the WWW-Authenticate header sent with a 401.
+func bearerChallenge(appErr *apperrors.Error) string {
+	if appErr == errInvalidToken {
+		return `Bearer realm="workshop", error="invalid_token"`
+	}
+	return `Bearer realm="workshop"`
+}
+
+// caller is who a request acts for.
+type caller struct {
+	// enforced is false when authentication is off, in which case a request
+	// may act for anyone, as it always could
+	enforced      bool
+	authenticated bool
+	identity      auth.Identity
+}
+
+// callerOf returns the caller authenticate found for the request.
+func callerOf(r *http.Request) caller {
+	c, _ := r.Context().Value(callerKey).(caller)
+	return c
+}
+
+// authenticate finds out who each request comes from, by its bearer token.
+// Requests without one go on anonymously, as reading workshops needs no
+// token, but a token that does not check out is turned away. With a nil
+// authenticator nothing is checked.
+func authenticate(authenticator *auth.Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := caller{enforced: authenticator != nil}
+			if header := r.Header.Get("Authorization"); c.enforced && header != "" {
+				scheme, token, _ := strings.Cut(header, " ")
+				if !strings.EqualFold(scheme, "Bearer") {
+					writeError(w, r, errInvalidToken)
+					return
+				}
+				identity, err := authenticator.Authenticate(strings.TrimSpace(token))
+				if err != nil {
+					requestLogger(r).Info("rejected a bearer token", "error", err.Error())
+					writeError(w, r, errInvalidToken)
+					return
+				}
+				c.authenticated, c.identity = true, identity
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey, c)))
+		})
+	}
+}
+
+// actFor returns the user a request acts for when it names userID. Callers
+// act for themselves, so userID may be left empty; only admins may name
+// someone else.
+func (c caller) actFor(userID string) (string, error) {
+	if !c.enforced {
+		return userID, nil
+	}
+	if !c.authenticated {
+		return "", errUnauthenticated
+	}
+	if userID == "" || userID == c.identity.Subject {
+		return c.identity.Subject, nil
+	}
+	if c.identity.Admin {
+		return userID, nil
+	}
+	return "", errForbidden
+}
+
+// mayManage fails unless the caller may change or delete the workshops of
+// creatorID: the creator themselves, or an admin.
+func (c caller) mayManage(creatorID string) error {
+	if !c.enforced {
+		return nil
+	}
+	if !c.authenticated {
+		return errUnauthenticated
+	}
+	if creatorID == c.identity.Subject || c.identity.Admin {
+		return nil
+	}
+	return errForbidden
+}
+
+// mayDelete fails unless the caller is an admin, as deleting a workshop
+// leaves its attendees untold.
+func (c caller) mayDelete() error {
+	if !c.enforced {
+		return nil
+	}
+	if !c.authenticated {
+		return errUnauthenticated
+	}
+	if c.identity.Admin {
+		return nil
+	}
+	return errAdminOnly
+}
@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"workshop/store"
+)
+
+// etag is the entity tag of a workshop. The version changes on every write,
+// so it is all the tag needs to carry.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// matchesEntityTags reports whether the header value, a comma separated list
+// of entity tags or "*", names the given version. Weak tags never match, as
+// If-Match requires a strong comparison.
+func matchesEntityTags(header string, version int64) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch turns the If-Match header into a store precondition, or nil when
+// the request has none.
+func ifMatch(r *http.Request) store.Precondition {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	return func(version int64) bool {
+		return matchesEntityTags(header, version)
+	}
+}
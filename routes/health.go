@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"net/http"
+
+	"workshop/health"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterHealthRoutes adds the probes used by the orchestrator. /livez only
+// says the process is up and serving; /readyz also checks every dependency
+// and answers 503 while any of them is unavailable.
+func RegisterHealthRoutes(r *mux.Router, checker *health.Checker) {
+	r.HandleFunc("/livez", livez).Methods("GET")
+	r.HandleFunc("/readyz", readyz(checker)).Methods("GET")
+}
+
+func livez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, map[string]string{"status": health.StatusOK})
+}
+
+func readyz(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Report(r.Context())
+		status := http.StatusOK
+		if report.Status != health.StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		// probes must never see a stale answer from a cache in between
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, status, report)
+	}
+}
@@ -0,0 +1,166 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+
+	"workshop/apperrors"
+	"workshop/idempotency"
+	"workshop/store"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// replayedHeader marks a response as a replay of the first one sent for
+	// its Idempotency-Key
+	replayedHeader = "Idempotent-Replayed"
+	// maxIdempotentBody bounds the bodies read up front to fingerprint them
+	maxIdempotentBody = 1 << 20
+)
+
+// replayedHeaders are the response headers kept along with the status and
+// body.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// validIdempotencyKey keeps keys printable; clients usually send a UUID.
+var validIdempotencyKey = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+
+var (
+	errIdempotencyKeyReused = apperrors.New(apperrors.Unprocessable, "idempotency_key_reused", "This Idempotency-Key was already used for a different request.")
+	errIdempotencyKeyInUse  = apperrors.New(apperrors.Conflict, "idempotency_key_in_use", "A request with this Idempotency-Key is still in progress.")
+)
+
+// idempotent returns a wrapper that honours the Idempotency-Key header. The
+// first request with a key is served as usual and its response kept; retries
+// with the same key, method, path and body get that response again, and
+// anything else sent with the key is turned away. Only responses that would
+// come out the same again are kept: ones that failed on the server's side,
+// were rate limited or lost a race with another change are forgotten, so the
+// retry is served afresh. With nil keys the header is ignored.
+//
+// An authenticated caller's keys are their own. Anonymous callers cannot be
+// told apart, so their keys only cover one method and path, and a response
+// is only replayed to a request with the same body: another caller sees it
+// only by sending the very same request under the same key.
+func idempotent(keys *idempotency.Keys) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if keys == nil {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if key == "" {
+				next(w, r)
+				return
+			}
+			if !validIdempotencyKey.MatchString(key) {
+				writeError(w, r, invalidField(idempotencyKeyHeader, "Idempotency-Key must be 1 to 255 printable characters"))
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+			if err != nil {
+				writeError(w, r, invalidBody)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// keys hold no spaces, so the parts cannot run into each other
+			scoped := "anonymous:" + key + " " + r.Method + " " + r.URL.Path
+			if c := callerOf(r); c.authenticated {
+				scoped = "user:" + c.identity.Subject + ":" + key
+			}
+			fingerprint := idempotency.Fingerprint(r.Method, r.URL.Path, body)
+			first, err := keys.Begin(r.Context(), scoped, fingerprint)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if first != nil {
+				switch {
+				case first.Fingerprint != fingerprint:
+					writeError(w, r, errIdempotencyKeyReused)
+				case !first.Done:
+					writeError(w, r, errIdempotencyKeyInUse)
+				default:
+					replay(w, first.Response)
+				}
+				return
+			}
+
+			capture := &capturingWriter{ResponseWriter: w}
+			next(capture, r)
+			// the response is kept even if the client has gone away, as it
+			// is the one most likely to retry
+			ctx := context.WithoutCancel(r.Context())
+			if capture.retryable() {
+				err = keys.Abandon(ctx, scoped)
+			} else {
+				err = keys.Finish(ctx, scoped, fingerprint, capture.response())
+			}
+			if err != nil {
+				requestLogger(r).Warn("could not keep the response to an idempotent request", "error", err.Error())
+			}
+		}
+	}
+}
+
+func replay(w http.ResponseWriter, response idempotency.Response) {
+	for name, value := range response.Header {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(replayedHeader, "true")
+	w.WriteHeader(response.Status)
+	w.Write(response.Body)
+}
+
+// capturingWriter keeps a copy of the response it passes on.
+type capturingWriter struct {
+	http.ResponseWriter
+	status int
+	header map[string]string
+	body   bytes.Buffer
+}
+
+func (c *capturingWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+		c.header = map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := c.ResponseWriter.Header().Get(name); value != "" {
+				c.header[name] = value
+			}
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *capturingWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.body.Write(p)
+	return c.ResponseWriter.Write(p)
+}
+
+// retryable reports whether the response may well differ if the request is
+// sent again, as it was never written, failed on the server's side, was rate
+// limited or lost a race with a concurrent change.
+func (c *capturingWriter) retryable() bool {
+	switch {
+	case c.status == 0, c.status >= http.StatusInternalServerError, c.status == http.StatusTooManyRequests:
+		return true
+	case c.status == http.StatusConflict:
+		var p problem
+		json.Unmarshal(c.body.Bytes(), &p)
+		return p.Code == store.ErrConflict.Code
+	}
+	return false
+}
+
+func (c *capturingWriter) response() idempotency.Response {
+	return idempotency.Response{Status: c.status, Header: c.header, Body: c.body.Bytes()}
+}
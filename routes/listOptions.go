@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"workshop/models"
+	"workshop/store"
+)
+
+// nextTokenHeader carries the token for the next page of a listing. The body
+// stays a plain JSON array so existing clients keep working.
+const nextTokenHeader = "X-Next-Token"
+
+// parseListOptions reads the paging, filtering and sorting query parameters
+// shared by the listing routes:
+//
+//	limit       page size, 1 to store.MaxPageSize
+//	next_token  value of the X-Next-Token header from the previous page
+//	location    exact location, case-insensitive
+//	title       title substring, case-insensitive
+//	has_vacancy true to only list workshops with seats left
+//	when        upcoming or past, by Start_Timestamp
+//	sort        start or -start
+//	status      comma separated statuses, such as published,registration_closed
+func parseListOptions(r *http.Request) (store.ListOptions, error) {
+	query := r.URL.Query()
+	opts := store.ListOptions{
+		NextToken: query.Get("next_token"),
+		Location:  query.Get("location"),
+		Title:     query.Get("title"),
+		When:      query.Get("when"),
+		Sort:      query.Get("sort"),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > store.MaxPageSize {
+			return opts, invalidField("limit", fmt.Sprintf("limit must be a number between 1 and %d", store.MaxPageSize))
+		}
+		opts.Limit = value
+	}
+	if hasVacancy := query.Get("has_vacancy"); hasVacancy != "" {
+		value, err := strconv.ParseBool(hasVacancy)
+		if err != nil {
+			return opts, invalidField("has_vacancy", "has_vacancy must be true or false")
+		}
+		opts.HasVacancy = value
+	}
+	if opts.When != "" && opts.When != store.WhenUpcoming && opts.When != store.WhenPast {
+		return opts, invalidField("when", "when must be upcoming or past")
+	}
+	if opts.Sort != "" && opts.Sort != store.SortByStart && opts.Sort != store.SortByStartDescending {
+		return opts, invalidField("sort", "sort must be start or -start")
+	}
+	if statuses := query.Get("status"); statuses != "" {
+		for _, status := range strings.Split(statuses, ",") {
+			status = strings.TrimSpace(status)
+			if !models.IsStatus(status) {
+				return opts, invalidField("status", "status must be one or more of "+strings.Join(models.Statuses, ", "))
+			}
+			opts.Statuses = append(opts.Statuses, status)
+		}
+	}
+	return opts, nil
+}
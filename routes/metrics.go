@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"workshop/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterMetricsRoutes exposes the Prometheus metrics on /metrics.
+func RegisterMetricsRoutes(r *mux.Router) {
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+}
+
+// withMetrics counts and times every request by the route template it
+// matched.
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := recorderFor(w)
+		next.ServeHTTP(rec, r)
+		route := routeTemplate(r)
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(rec.statusOrOK())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware wraps the router in the stack every request goes through.
+// Request IDs, the matched route and the trace come first so everything
+// after can log them; panics are recovered inside the logging and metrics so
+// they are logged and counted like any other failed request.
+func Middleware(next http.Handler) http.Handler {
+	return withRequestID(withRouteTemplate(next, withTracing(withLogging(withMetrics(withRecovery(next))))))
+}
+
+// responseRecorder remembers what a handler did with the response, so the
+// middleware can tell whether it failed.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	// writeErr is the first failed write, typically a client that went away
+	writeErr error
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	if err != nil && rec.writeErr == nil {
+		rec.writeErr = err
+	}
+	return n, err
+}
+
+// statusOrOK is the status sent, counting a handler that never wrote
+// anything as a 200.
+func (rec *responseRecorder) statusOrOK() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func recorderFor(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+// withLogging logs every request once it is done: failures on our side as
+// errors, responses that could not be delivered as warnings and the rest at
+// info level. Requests are named by their route template, as paths may hold
+// user IDs.
+func withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := recorderFor(w)
+		next.ServeHTTP(rec, r)
+		attrs := []any{
+			"method", r.Method,
+			"route", routeTemplate(r),
+			"status", rec.statusOrOK(),
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+		}
+		logger := requestLogger(r)
+		switch {
+		case rec.writeErr != nil:
+			logger.Warn("could not write the response", append(attrs, "error", rec.writeErr.Error())...)
+		case rec.statusOrOK() >= http.StatusInternalServerError:
+			logger.Error("request failed", attrs...)
+		default:
+			logger.Info("request served", attrs...)
+		}
+	})
+}
+
+// withRecovery turns a panicking handler into a 500 for that one request,
+// rather than a crashed connection.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recorderFor(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// the server uses this panic to abort a response on purpose
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+			requestLogger(r).Error("handler panicked", "method", r.Method, "route", routeTemplate(r), "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+			if rec.status == 0 {
+				writeError(rec, r, errors.New("handler panicked"))
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
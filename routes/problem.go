@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"workshop/apperrors"
+)
+
+const problemContentType = "application/problem+json"
+
+// problemTypePrefix turns an error code into the problem's type URI.
+const problemTypePrefix = "urn:greenharbor:workshop:problem:"
+
+// problem is an RFC 7807 problem details body. Message repeats Detail for
+// clients written against the old {"message": ...} errors.
+type problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail"`
+	Instance  string            `json:"instance"`
+	Code      string            `json:"code"`
+	RequestID string            `json:"request_id"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Message   string            `json:"message"`
+}
+
+// statusOf maps each kind of domain error to its HTTP status code.
+func statusOf(kind apperrors.Kind) int {
+	switch kind {
+	case apperrors.NotFound:
+		return http.StatusNotFound
+	case apperrors.AlreadyRegistered, apperrors.NotRegistered, apperrors.Validation:
+		return http.StatusBadRequest
+	case apperrors.Closed, apperrors.Forbidden:
+		return http.StatusForbidden
+	case apperrors.Unauthenticated:
+		return http.StatusUnauthorized
+	case apperrors.Full, apperrors.Conflict:
+		return http.StatusConflict
+	case apperrors.PreconditionFailed:
+		return http.StatusPreconditionFailed
+	case apperrors.Unavailable:
+		return http.StatusServiceUnavailable
+	case apperrors.RateLimited:
+		return http.StatusTooManyRequests
+	case apperrors.Unprocessable:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errRequestCanceled is what a store call fails with once the request it
+// serves has been cancelled, typically because the client went away.
+var errRequestCanceled = apperrors.New(apperrors.Unavailable, "request_canceled", "The request was cancelled before it completed.")
+
+// writeError sends err as a problem. Errors the service did not expect are
+// logged, since the client only gets to see a generic message.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	appErr := apperrors.From(err)
+	if appErr.Kind == apperrors.Internal && r.Context().Err() != nil {
+		appErr = errRequestCanceled
+	}
+	if appErr.Kind == apperrors.Internal {
+		requestLogger(r).Error("unexpected error", "method", r.Method, "route", routeTemplate(r), "error", err.Error())
+	}
+	if appErr.Kind == apperrors.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", bearerChallenge(appErr))
+	}
+	writeProblem(w, r, statusOf(appErr.Kind), appErr)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, appErr *apperrors.Error) {
+	body, _ := json.Marshal(problem{
+		Type:      problemTypePrefix + appErr.Code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    appErr.Message,
+		Instance:  r.URL.Path,
+		Code:      appErr.Code,
+		RequestID: requestID(r),
+		Fields:    appErr.Fields,
+		Message:   appErr.Message,
+	})
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	// a client that went away is logged by withLogging
+	w.Write(body)
+}
+
+// writeJSON sends body as JSON with the given status code.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// a client that went away is logged by withLogging
+	w.Write(encoded)
+}
+
+// invalidBody is the error for a request body that is not the JSON expected.
+var invalidBody = apperrors.New(apperrors.Validation, "invalid_body", "Invalid Request Data.")
+
+// invalidField reports a single malformed field of the request.
+func invalidField(field string, message string) error {
+	return apperrors.NewValidation("validation_failed", message, map[string]string{field: message})
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, apperrors.New(apperrors.NotFound, "route_not_found", "No route matches "+r.URL.Path+"."))
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	message := r.Method + " is not allowed on " + r.URL.Path + "."
+	writeProblem(w, r, http.StatusMethodNotAllowed, apperrors.New(apperrors.Validation, "method_not_allowed", message))
+}
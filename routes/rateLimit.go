@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"workshop/apperrors"
+	"workshop/metrics"
+	"workshop/ratelimit"
+)
+
+var errRateLimited = apperrors.New(apperrors.RateLimited, "rate_limited", "Too many requests, please retry later.")
+
+// limitRate returns a wrapper that puts a route in one of the groups of
+// limits. Each client has a bucket per group: the user its bearer token
+// names, or else its IP address. With nil limits nothing is limited.
+func limitRate(limits *ratelimit.Limits) func(group string, next http.HandlerFunc) http.HandlerFunc {
+	return func(group string, next http.HandlerFunc) http.HandlerFunc {
+		if limits == nil {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			client := "ip:" + limits.ClientIP(r)
+			if c := callerOf(r); c.authenticated {
+				client = "user:" + c.identity.Subject
+			}
+			if ok, wait := limits.Allow(group, client); !ok {
+				metrics.RateLimited.WithLabelValues(group).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfter(wait)))
+				writeError(w, r, errRateLimited)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
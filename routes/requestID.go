@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDHeader carries the request ID. A caller may send one to tie our
+// errors to its own logs; otherwise one is generated.
+const requestIDHeader = "X-Request-Id"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	routeTemplateKey
+	callerKey
+)
+
+// validRequestID keeps caller supplied IDs short and printable.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// withRequestID gives every request an ID, echoed in the X-Request-Id
+// response header, in every error body and in every log line about it.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// requestID is the ID withRequestID gave the request.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// requestLogger is the default logger with the request's ID attached, and
+// its trace ID when it is traced.
+func requestLogger(r *http.Request) *slog.Logger {
+	logger := slog.Default().With("request_id", requestID(r))
+	if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+		logger = logger.With("trace_id", spanContext.TraceID().String())
+	}
+	return logger
+}
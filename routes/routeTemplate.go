@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// unmatchedRoute labels requests that matched no route, so stray paths do not
+// each get metrics and log values of their own.
+const unmatchedRoute = "unmatched"
+
+// withRouteTemplate works out which route of router the request matches, so
+// metrics and logs can name it by its template, such as /workshop/id/{id},
+// rather than by a path that may hold IDs.
+func withRouteTemplate(router http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template := matchRouteTemplate(router, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeTemplateKey, template)))
+	})
+}
+
+// routeTemplate is the template withRouteTemplate matched the request to.
+func routeTemplate(r *http.Request) string {
+	if template, ok := r.Context().Value(routeTemplateKey).(string); ok {
+		return template
+	}
+	return unmatchedRoute
+}
+
+func matchRouteTemplate(router http.Handler, r *http.Request) string {
+	muxRouter, ok := router.(*mux.Router)
+	if !ok {
+		return unmatchedRoute
+	}
+	var match mux.RouteMatch
+	if !muxRouter.Match(r, &match) || match.Route == nil {
+		return unmatchedRoute
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return template
+}
@@ -2,586 +2,574 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
-	"workshop/helpers"
+	"unicode/utf8"
+	"workshop/apperrors"
+	"workshop/auth"
+	"workshop/idempotency"
+	"workshop/logging"
+	"workshop/metrics"
 	"workshop/models"
+	"workshop/ratelimit"
+	"workshop/store"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/thoas/go-funk"
 )
-var tableName string
 
-func RegisterRoutes(r *mux.Router, svc *dynamodb.DynamoDB, table string) {
-	tableName = table
+// Options turns on the routes' optional features. Each one is off while its
+// field is nil, so the zero Options serves the plain routes.
+type Options struct {
+	// Authenticator identifies callers by their bearer tokens. Without it
+	// callers are not identified at all, and may act for anyone.
+	Authenticator *auth.Authenticator
+	// Limits holds callers to their rate limits.
+	Limits *ratelimit.Limits
+	// Keys keeps the responses to creating, registering and withdrawing, so
+	// the Idempotency-Key header is honoured.
+	Keys *idempotency.Keys
+}
+
+// RegisterRoutes adds the service's routes to r, with the features opts
+// turns on. Serve r through Middleware. The store announces every change the
+// routes make.
+func RegisterRoutes(r *mux.Router, workshops store.WorkshopStore, opts Options) {
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
+	r.Use(authenticate(opts.Authenticator))
+	limited := limitRate(opts.Limits)
+	once := idempotent(opts.Keys)
+	reads := func(h http.HandlerFunc) http.HandlerFunc { return limited(ratelimit.GroupReads, h) }
+	writes := func(h http.HandlerFunc) http.HandlerFunc { return limited(ratelimit.GroupWrites, h) }
+	registration := func(h http.HandlerFunc) http.HandlerFunc { return limited(ratelimit.GroupRegistration, h) }
 	r.HandleFunc("/health", health_check)
-	r.HandleFunc("/workshop", get_all(svc)).Methods("GET")
-	r.HandleFunc("/workshop/{creator_id}", get_by_creatorID(svc)).Methods("GET")
-	r.HandleFunc("/workshop", create(svc)).Methods("POST")
-	r.HandleFunc("/workshop/{creator_id}/{creation_timestamp}", patch(svc)).Methods("PATCH")
-	r.HandleFunc("/workshop/{creator_id}/{creation_timestamp}", delete(svc)).Methods("DELETE")
-	r.HandleFunc("/workshop/register/{creator_id}/{creation_timestamp}", register(svc)).Methods("PATCH")
-	r.HandleFunc("/workshop/withdraw/{creator_id}/{creation_timestamp}", withdraw(svc)).Methods("PATCH")
+	r.HandleFunc("/workshop", reads(get_all(workshops))).Methods("GET")
+	// workshops are addressed by Workshop_Id; the Creator_Id and
+	// Creation_Timestamp routes further down are kept as aliases
+	r.HandleFunc("/workshop/id/{id}", reads(get_workshop(workshops))).Methods("GET")
+	r.HandleFunc("/workshop/id/{id}", writes(patch(workshops))).Methods("PATCH")
+	r.HandleFunc("/workshop/id/{id}", writes(delete(workshops))).Methods("DELETE")
+	r.HandleFunc("/workshop/id/{id}/register", registration(once(register(workshops)))).Methods("PATCH")
+	r.HandleFunc("/workshop/id/{id}/withdraw", registration(once(withdraw(workshops)))).Methods("PATCH")
+	r.HandleFunc("/workshop/id/{id}/publish", writes(change_status(workshops, models.StatusPublished))).Methods("PATCH")
+	r.HandleFunc("/workshop/id/{id}/close", writes(change_status(workshops, models.StatusRegistrationClosed))).Methods("PATCH")
+	r.HandleFunc("/workshop/id/{id}/cancel", writes(cancel(workshops))).Methods("PATCH")
+	r.HandleFunc("/workshop/id/{id}/complete", writes(change_status(workshops, models.StatusCompleted))).Methods("PATCH")
+	r.HandleFunc("/workshop/id/{id}/waitlist/leave", registration(leave_waitlist(workshops))).Methods("PATCH")
+	r.HandleFunc("/workshop/id/{id}/waitlist/{user_id}", reads(waitlist_position(workshops))).Methods("GET")
+	r.HandleFunc("/workshop/{creator_id}", reads(get_by_creatorID(workshops))).Methods("GET")
+	r.HandleFunc("/workshop/{creator_id}/{creation_timestamp}", reads(get_workshop(workshops))).Methods("GET")
+	r.HandleFunc("/workshop", writes(once(create(workshops)))).Methods("POST")
+	r.HandleFunc("/workshop/{creator_id}/{creation_timestamp}", writes(patch(workshops))).Methods("PATCH")
+	r.HandleFunc("/workshop/{creator_id}/{creation_timestamp}", writes(delete(workshops))).Methods("DELETE")
+	r.HandleFunc("/workshop/register/{creator_id}/{creation_timestamp}", registration(once(register(workshops)))).Methods("PATCH")
+	r.HandleFunc("/workshop/withdraw/{creator_id}/{creation_timestamp}", registration(once(withdraw(workshops)))).Methods("PATCH")
+	r.HandleFunc("/workshop/waitlist/{creator_id}/{creation_timestamp}/{user_id}", reads(waitlist_position(workshops))).Methods("GET")
+	r.HandleFunc("/workshop/waitlist/leave/{creator_id}/{creation_timestamp}", registration(leave_waitlist(workshops))).Methods("PATCH")
+	r.HandleFunc("/users/{user_id}/registrations", reads(get_registrations(workshops))).Methods("GET")
 }
 
 func health_check(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, r, http.StatusOK, map[string]string{
+		"message": "Service is healthy",
+		"service": "Workshop",
+	})
+}
 
-	resp := make(map[string]string)
-	resp["message"] = "Service is healthy"
-	resp["service"] = "Workshop"
-	jsonResp, err := json.Marshal(resp)
+// maxCreateAttempts bounds how often create picks a new Creation_Timestamp
+// when another workshop by the same creator took the same millisecond.
+const maxCreateAttempts = 3
 
-	if err != nil {
-		log.Fatalf("Error happened in JSON marshal. Err: %s", err)
-		w.WriteHeader(500)
-		return
+// workshopKey returns the Creator_Id and Creation_Timestamp of the workshop a
+// request is about, looking it up when the route addresses it by Workshop_Id.
+func workshopKey(workshops store.WorkshopStore, r *http.Request) (string, string, error) {
+	vars := mux.Vars(r)
+	if id, ok := vars["id"]; ok {
+		workshop, err := workshops.GetByID(r.Context(), id)
+		if err != nil {
+			return "", "", err
+		}
+		return workshop.Creator_Id, workshop.Creation_Timestamp, nil
 	}
+	return vars["creator_id"], vars["creation_timestamp"], nil
+}
 
-	if _, err := w.Write(jsonResp); err != nil {
-		log.Fatalf("Unable to write JSON: %s", err)
-		return
+// getWorkshop fetches the workshop a request is about, by Workshop_Id or by
+// its composite key.
+func getWorkshop(workshops store.WorkshopStore, r *http.Request) (models.Workshop, error) {
+	vars := mux.Vars(r)
+	if id, ok := vars["id"]; ok {
+		return workshops.GetByID(r.Context(), id)
 	}
+	return workshops.Get(r.Context(), vars["creator_id"], vars["creation_timestamp"])
+}
 
-	w.WriteHeader(200)
+// userIDFromBody reads the User_Id that the registration routes act for.
+// With authentication on it defaults to the caller, so the body may be left
+// out, and only admins may name another user.
+func userIDFromBody(r *http.Request) (string, error) {
+	c := callerOf(r)
+	if _, err := c.actFor(""); err != nil {
+		return "", err
+	}
+	var requestBody map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&requestBody); err != nil && !(c.enforced && errors.Is(err, io.EOF)) {
+		return "", invalidBody
+	}
+	value, given := requestBody["User_Id"]
+	userID, ok := value.(string)
+	if given && !ok || !given && !c.enforced {
+		return "", invalidField("User_Id", "User_Id given is not a string!")
+	}
+	return c.actFor(userID)
 }
 
-func get_all(svc *dynamodb.DynamoDB) http.HandlerFunc {
+func get_all(workshops store.WorkshopStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		resp := make(map[string]string)
-		handleError := func(message string, statusCode int) {
-			resp["message"] = message
-			w.WriteHeader(statusCode)
-			jsonResponse, _ := json.Marshal(resp)
-			if _, err := w.Write(jsonResponse); err != nil {
-				log.Fatalf("Unable to write JSON: %s", err)
-				return
-			}
-		}
-	
-		// Build the dynamoDB scan input
-		input := &dynamodb.ScanInput{
-			TableName: aws.String(tableName),
-		}
-		// Perform the scan on dynamoDB
-		result, err := svc.Scan(input)
+		opts, err := parseListOptions(r)
 		if err != nil {
-			errMsg := err.Error()
-			handleError(errMsg, 500)
+			writeError(w, r, err)
 			return
 		}
-	
-		var workshops []interface{}
-	
-		for _, i := range result.Items {
-			// Unmarshal DynamoDB JSON format to the workshop model
-			var workshop_model models.Workshop
-			err = dynamodbattribute.UnmarshalMap(i, &workshop_model)
-			if err != nil {
-				handleError("Error unmarshalling dynamoDB JSON format to the workshop model", 500)
-				return
-			}
-	
-			// Append the unmarshalled item to the workshops array
-			workshops = append(workshops, workshop_model)
-		}
-	
-		// Marshal the workshops array to create a JSON array
-		workshopsJSON, err := json.Marshal(workshops)
+		render, err := parseRenderZone(r)
 		if err != nil {
-			handleError("Error marshalling workshop models to JSON", 500)
+			writeError(w, r, err)
+			return
 		}
-		// Send the JSON response to the client
-		w.WriteHeader(http.StatusOK)
-	
-		if _, err := w.Write(workshopsJSON); err != nil {
-			log.Fatalf("Unable to write JSON: %s", err)
+		page, err := workshops.List(r.Context(), opts)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
+		if page.NextToken != "" {
+			w.Header().Set(nextTokenHeader, page.NextToken)
+		}
+
+		// Send the workshops as a JSON array
+		writeJSON(w, r, http.StatusOK, renderAll(page.Workshops, render))
 	}
 }
 
-func get_by_creatorID(svc *dynamodb.DynamoDB) http.HandlerFunc{
-	return func (w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		resp := make(map[string]string)
-		handleError := func(message string, statusCode int) {
-			resp["message"] = message
-			w.WriteHeader(statusCode)
-			jsonResponse, _ := json.Marshal(resp)
-			if _, err := w.Write(jsonResponse); err != nil {
-				log.Fatalf("Unable to write JSON: %s", err)
-				return
-			}
-		}
-
+func get_by_creatorID(workshops store.WorkshopStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		//get the partition key, creator_id from the url
-		vars := mux.Vars(r)
-		creatorID := vars["creator_id"]
-
-		// Create the QueryInput
-		input := &dynamodb.QueryInput{
-			TableName:              aws.String(tableName),
-			KeyConditionExpression: aws.String("Creator_Id = :val"),
-			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-				":val": {
-					S: aws.String(creatorID),
-				},
-			},
-		}
-		// Perform the Query operation
-		result, err := svc.Query(input)
+		creatorID := mux.Vars(r)["creator_id"]
+
+		opts, err := parseListOptions(r)
 		if err != nil {
-			errorMsg := "Error querying items with Creator_Id: " + creatorID
-			handleError(errorMsg, 404)
+			writeError(w, r, err)
 			return
 		}
-
-		var workshops []interface{}
-		for _, i := range result.Items {
-			// Unmarshal DynamoDB JSON format to the workshop model
-			var workshop_model models.Workshop
-			err = dynamodbattribute.UnmarshalMap(i, &workshop_model)
-			if err != nil {
-				handleError("Error unmarshalling dynamoDB JSON format to the workshop model", 500)
-				return
-			}
-			// Append the unmarshalled item to the workshops array
-			workshops = append(workshops, workshop_model)
+		render, err := parseRenderZone(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		page, err := workshops.ListByCreator(r.Context(), creatorID, opts)
+		if err != nil {
+			writeError(w, r, fmt.Errorf("querying items by Creator_Id: %w", err))
+			return
+		}
+		if page.NextToken != "" {
+			w.Header().Set(nextTokenHeader, page.NextToken)
 		}
 
-		// Marshal the workshops array to create a JSON array
-		workshopsJSON, err := json.Marshal(workshops)
+		// Send the workshops as a JSON array
+		writeJSON(w, r, http.StatusOK, renderAll(page.Workshops, render))
+	}
+}
+
+func get_workshop(workshops store.WorkshopStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render, err := parseRenderZone(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		workshop, err := getWorkshop(workshops, r)
 		if err != nil {
-			handleError("Error marshalling workshop models to JSON", 500)
+			writeError(w, r, err)
+			return
 		}
-		// Send the JSON response to the client
-		w.WriteHeader(http.StatusOK)
 
-		if _, err := w.Write(workshopsJSON); err != nil {
-			log.Fatalf("Unable to write JSON: %s", err)
+		// the ETag lets clients make their next write conditional with If-Match
+		w.Header().Set("ETag", etag(workshop.Version))
+		if match := r.Header.Get("If-None-Match"); match != "" && matchesEntityTags(match, workshop.Version) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
+
+		writeJSON(w, r, http.StatusOK, render(workshop))
 	}
 }
 
-func create(svc *dynamodb.DynamoDB) http.HandlerFunc{
+func create(workshops store.WorkshopStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		resp := make(map[string]string)
-		handleError := func(message string, statusCode int) {
-			resp["message"] = message
-			w.WriteHeader(statusCode)
-			jsonResponse, _ := json.Marshal(resp)
-
-			if _, err := w.Write(jsonResponse); err != nil {
-				log.Fatalf("Unable to write JSON: %s", err)
-				return
-			}
-		}
-
 		// Parse the request body into the Workshop struct
 		var request models.Workshop
 		err := json.NewDecoder(r.Body).Decode(&request)
-		if request.Creator_Id == "" {
-			handleError("Missing creator_ID", 400)
+		if err != nil {
+			writeError(w, r, invalidBody)
 			return
 		}
+		// workshops are created by the caller, unless an admin creates one for someone else
+		request.Creator_Id, err = callerOf(r).actFor(request.Creator_Id)
 		if err != nil {
-			handleError("Invalid request data.", 400)
+			writeError(w, r, err)
 			return
 		}
-		//append a creation timestamp and empty attendees list to the request body
-		currentTimeUTC := time.Now().UTC().Add(8 * time.Hour)
-		request.Creation_Timestamp = currentTimeUTC.Format("2006-01-02-15:04:05.000")
-		request.Attendees = []string{}
-
-		//marshall the struct into an attribute value object
-		av, err := dynamodbattribute.MarshalMap(request)
-		if err != nil {
-			handleError("Error marshalling data into an attribute value object.", 400)
+		if request.Creator_Id == "" {
+			writeError(w, r, invalidField("Creator_Id", "Missing creator_ID"))
 			return
 		}
-		// Insert the data into the database
-		input := &dynamodb.PutItemInput{
-			Item:      av,
-			TableName: aws.String(tableName),
+		if request.Vacancies < 0 || request.Vacancies > models.MaxVacancies {
+			writeError(w, r, invalidField("Vacancies", fmt.Sprintf("Vacancies must be between 0 and %d", models.MaxVacancies)))
+			return
 		}
-		_, err = svc.PutItem(input)
-		if err != nil {
-			handleError("Error inserting workshop data into the database.", 500)
+		if request.Time_Zone == "" {
+			request.Time_Zone = models.DefaultTimeZone
+		}
+		// workshops open for registration straight away unless they are drafts
+		switch request.Status {
+		case "":
+			request.Status = models.StatusPublished
+		case models.StatusDraft, models.StatusPublished:
+		default:
+			writeError(w, r, invalidField("Status", "Status must be draft or published"))
 			return
 		}
-
-		resp["message"] = "Workshop created successfully."
-		w.WriteHeader(201)
-		jsonResponse, _ := json.Marshal(resp)
-
-		if _, err := w.Write(jsonResponse); err != nil {
-			log.Fatalf("Unable to write JSON: %s", err)
+		if err := request.NormalizeSchedule(); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		now := time.Now()
+		if err := request.ValidateSchedule(now); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		//append an id, a creation timestamp and empty attendees list to the request body
+		request.Workshop_Id = uuid.NewString()
+		request.Attendees = []string{}
+		request.Waitlist = []string{}
+		request.Cancellation_Reason = ""
+		request.Version = 0
+
+		// Insert the data into the database. The key only has millisecond
+		// precision, so a creator posting twice at once needs another timestamp.
+		for attempt := 0; ; attempt++ {
+			request.Creation_Timestamp = models.FormatTimestamp(now.Add(time.Duration(attempt) * time.Millisecond))
+			err = workshops.Create(r.Context(), request)
+			if !errors.Is(err, store.ErrAlreadyExists) || attempt+1 == maxCreateAttempts {
+				break
+			}
+		}
+		if err != nil {
+			writeError(w, r, fmt.Errorf("inserting workshop data into the database: %w", err))
 			return
 		}
+		metrics.WorkshopsCreated.Inc()
+
+		w.Header().Set("Location", "/workshop/id/"+request.Workshop_Id)
+		writeJSON(w, r, http.StatusCreated, map[string]string{
+			"message":            "Workshop created successfully.",
+			"Workshop_Id":        request.Workshop_Id,
+			"Creator_Id":         request.Creator_Id,
+			"Creation_Timestamp": request.Creation_Timestamp,
+		})
 	}
 }
 
-func patch(svc *dynamodb.DynamoDB) http.HandlerFunc{
+func patch(workshops store.WorkshopStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		resp := make(map[string]string)
-		handleError := func(message string, statusCode int) {
-			resp["message"] = message
-			w.WriteHeader(statusCode)
-			jsonResponse, _ := json.Marshal(resp)
-			if _, err := w.Write(jsonResponse); err != nil {
-				log.Fatalf("Unable to write JSON: %s", err)
-				return
-			}
+		//get the partition and sort key from the url
+		creatorID, creationTimestamp, err := workshopKey(workshops, r)
+		if err != nil {
+			writeError(w, r, err)
+			return
 		}
-
-		//get the partition and sort key from the url and parse it into key
-		vars := mux.Vars(r)
-		creatorID := vars["creator_id"]
-		creationTimestamp := vars["creation_timestamp"]
-		key := map[string]*dynamodb.AttributeValue{
-			"Creator_Id": {
-				S: aws.String(creatorID),
-			},
-			"Creation_Timestamp": {
-				S: aws.String(creationTimestamp),
-			},
+		if err := callerOf(r).mayManage(creatorID); err != nil {
+			writeError(w, r, err)
+			return
 		}
 
-		// Create a map to hold the fields from the JSON request body
-		var updateFields map[string]interface{}
-		// Parse the JSON request body into the updateFields map
+		// Parse the JSON request body field by field, so each one can be checked against the schema
+		var body map[string]json.RawMessage
 		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&updateFields); err != nil {
-			handleError("Invalid Request Data.", 400)
-			return
-		}
-
-		// create the dynamoDB update expression and map to hold the expression attribute values
-		updateExpression := "SET "
-		expressionAttributeValues := map[string]*dynamodb.AttributeValue{}
-		//loop through updatefields map to populate the updateExpression and expressionAttributeValues
-		for key, value := range updateFields {
-			attrValue := &dynamodb.AttributeValue{}
-
-			switch v := value.(type) {
-			case string:
-				attrValue.S = aws.String(v)
-			case float64: //unmarshalled json ints are often converted to float64
-				intValue := int(v)
-				attrValue.N = aws.String(strconv.Itoa(intValue))
-			case int:
-				attrValue.N = aws.String(strconv.Itoa(v))
-			default:
-				handleError("You may not patch this field", 400)
-				return
-			}
-			expressionAttributeValues[":"+key] = attrValue
-			updateExpression = updateExpression + key + " = :" + key + ", "
+		if err := decoder.Decode(&body); err != nil || len(body) == 0 {
+			writeError(w, r, invalidBody)
+			return
+		}
+		patch, problems := models.ParseWorkshopPatch(body)
+		if len(problems) > 0 {
+			writeError(w, r, apperrors.NewValidation("validation_failed", "Invalid Request Data.", problems))
+			return
 		}
-		updateExpression = updateExpression[:len(updateExpression)-2]
 
-		// Specify the update input.
-		updateInput := &dynamodb.UpdateItemInput{
-			TableName:                 aws.String(tableName),
-			Key:                       key,
-			UpdateExpression:          aws.String(updateExpression),
-			ExpressionAttributeValues: expressionAttributeValues,
+		updated, err := workshops.Update(r.Context(), creatorID, creationTimestamp, patch, ifMatch(r))
+		if err != nil {
+			writeError(w, r, err)
+			return
 		}
+		w.Header().Set("ETag", etag(updated.Version))
+		writeJSON(w, r, http.StatusOK, map[string]string{"message": "Workshop updated successfully."})
+	}
+}
 
-		// Execute the update operation.
-		_, err := svc.UpdateItem(updateInput)
+// change_status moves a workshop to status, as far as its current status
+// allows. Only its creator, or an admin, may.
+func change_status(workshops store.WorkshopStore, status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		creatorID, creationTimestamp, err := workshopKey(workshops, r)
 		if err != nil {
-			handleError("Error updating the database", 500)
+			writeError(w, r, err)
+			return
+		}
+		if err := callerOf(r).mayManage(creatorID); err != nil {
+			writeError(w, r, err)
 			return
 		}
-		resp["message"] = "Workshop updated successfully."
-		w.WriteHeader(200)
-		jsonResponse, _ := json.Marshal(resp)
 
-		if _, err := w.Write(jsonResponse); err != nil {
-			log.Fatalf("Unable to write JSON: %s", err)
+		updated, err := workshops.Transition(r.Context(), creatorID, creationTimestamp, status, ifMatch(r))
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
+		w.Header().Set("ETag", etag(updated.Version))
+		writeJSON(w, r, http.StatusOK, map[string]string{
+			"message": "Workshop status changed successfully.",
+			"Status":  updated.Status,
+		})
 	}
 }
 
-func delete(svc *dynamodb.DynamoDB) http.HandlerFunc{
+// cancel cancels a workshop for the reason in the body. Its attendees and
+// everyone on its waitlist are told by the notices sent from the
+// cancellation's event, once the outbox relays it. Unlike deleting, the
+// workshop and its attendees are kept.
+func cancel(workshops store.WorkshopStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		resp := make(map[string]string)
-		handleError := func(message string, statusCode int) {
-			resp["message"] = message
-			w.WriteHeader(statusCode)
-			jsonResponse, _ := json.Marshal(resp)
-
-			if _, err := w.Write(jsonResponse); err != nil {
-				log.Fatalf("Unable to write JSON: %s", err)
-				return
-			}
+		creatorID, creationTimestamp, err := workshopKey(workshops, r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := callerOf(r).mayManage(creatorID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		var request struct {
+			Reason string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, r, invalidBody)
+			return
+		}
+		reason := strings.TrimSpace(request.Reason)
+		if length := utf8.RuneCountInString(reason); length < 1 || length > models.MaxReasonLength {
+			writeError(w, r, invalidField("Reason", fmt.Sprintf("Reason must be between 1 and %d characters", models.MaxReasonLength)))
+			return
 		}
 
-		//get the partition and sort key from the url and parse it into key
-		vars := mux.Vars(r)
-		creatorID := vars["creator_id"]
-		creationTimestamp := vars["creation_timestamp"]
-		key := map[string]*dynamodb.AttributeValue{
-			"Creator_Id": {
-				S: aws.String(creatorID),
-			},
-			"Creation_Timestamp": {
-				S: aws.String(creationTimestamp),
-			},
+		cancelled, err := workshops.Cancel(r.Context(), creatorID, creationTimestamp, reason, ifMatch(r))
+		if err != nil {
+			writeError(w, r, err)
+			return
 		}
+		requestLogger(r).Info("workshop cancelled", logging.CreatorID(creatorID), "creation_timestamp", creationTimestamp)
+		w.Header().Set("ETag", etag(cancelled.Version))
+		writeJSON(w, r, http.StatusOK, map[string]string{
+			"message": "Workshop cancelled successfully.",
+			"Status":  cancelled.Status,
+		})
+	}
+}
 
-		// Define the input for the DeleteItem operation.
-		input := &dynamodb.DeleteItemInput{
-			TableName: aws.String(tableName),
-			Key:       key,
+// delete removes a workshop for good. Only admins may, as its attendees are
+// not told; creators cancel their workshops instead. The caller is checked
+// before the workshop is looked up, so other callers cannot tell from the
+// answer which workshops exist.
+func delete(workshops store.WorkshopStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := callerOf(r).mayDelete(); err != nil {
+			writeError(w, r, err)
+			return
 		}
-		// Delete the item.
-		_, err := svc.DeleteItem(input)
+		//get the partition and sort key from the url
+		creatorID, creationTimestamp, err := workshopKey(workshops, r)
 		if err != nil {
-			handleError("Unable to delete item. Check if creatorID and creationTimestamp is correct?", 500)
+			writeError(w, r, err)
 			return
 		}
 
-		resp["message"] = fmt.Sprintf("Workshop with creator_id %s and creation_timestamp %s deleted successfully.", creatorID, creationTimestamp)
-		w.WriteHeader(200)
-		jsonResponse, _ := json.Marshal(resp)
-
-		if _, err := w.Write(jsonResponse); err != nil {
-			log.Fatalf("Unable to write JSON: %s", err)
+		// Delete the item.
+		if err := workshops.Delete(r.Context(), creatorID, creationTimestamp, ifMatch(r)); err != nil {
+			writeError(w, r, err)
 			return
 		}
+
+		writeJSON(w, r, http.StatusOK, map[string]string{
+			"message": fmt.Sprintf("Workshop with creator_id %s and creation_timestamp %s deleted successfully.", creatorID, creationTimestamp),
+		})
 	}
 }
 
-func register(svc *dynamodb.DynamoDB) http.HandlerFunc{
+func register(workshops store.WorkshopStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		resp := make(map[string]string)
-		handleError := func(message string, statusCode int) {
-			resp["message"] = message
-			w.WriteHeader(statusCode)
-			jsonResponse, _ := json.Marshal(resp)
-
-			if _, err := w.Write(jsonResponse); err != nil {
-				log.Fatalf("Unable to write JSON: %s", err)
+		//get the partition and sort key from the url
+		creatorID, creationTimestamp, err := workshopKey(workshops, r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		userID, err := userIDFromBody(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		// ?waitlist=false turns down a seat on the waitlist when the workshop is full
+		joinWaitlist := true
+		if waitlist := r.URL.Query().Get("waitlist"); waitlist != "" {
+			joinWaitlist, err = strconv.ParseBool(waitlist)
+			if err != nil {
+				writeError(w, r, invalidField("waitlist", "waitlist must be true or false"))
 				return
 			}
 		}
 
-		//get the partition and sort key from the url and parse it into key
-		vars := mux.Vars(r)
-		creatorID := vars["creator_id"]
-		creationTimestamp := vars["creation_timestamp"]
-		key := map[string]*dynamodb.AttributeValue{
-			"Creator_Id": {
-				S: aws.String(creatorID),
-			},
-			"Creation_Timestamp": {
-				S: aws.String(creationTimestamp),
-			},
-		}
-		// Extract userID from the JSON request body
-		var requestBody map[string]interface{}
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&requestBody); err != nil {
-			handleError("Invalid Request Data.", 400)
-			return
+		registration, err := workshops.Register(r.Context(), creatorID, creationTimestamp, userID, joinWaitlist, ifMatch(r))
+		if errors.Is(err, store.ErrWorkshopFull) {
+			metrics.RegistrationsRejectedFull.Inc()
 		}
-		var userID string
-		if user_id, ok := requestBody["User_Id"].(string); ok {
-			userID = user_id
-		} else {
-			handleError("User_Id given is not a string!", 400)
-			return
-		}
-		//get the attendees and vacancy of the current workshop
-		var attendeesAndVacancy helpers.AttendeesAndVacancy
-		attendeesAndVacancy, err := helpers.GetAttendeesAndVacancy(creatorID, creationTimestamp, svc, tableName)
 		if err != nil {
-			errorMessage := err.Error()
-			if errorMessage == "Workshop not found." {
-				handleError(errorMessage, 404)
-			} else {
-				handleError(errorMessage, 500)
-			}
+			writeError(w, r, err)
 			return
 		}
-		attendees := attendeesAndVacancy.Attendees
-		vacancies := attendeesAndVacancy.Vacancies
-		//IF USER IS ALREADY IN ATTENDEE LIST, return an error
-		if funk.Contains(attendees, userID) {
-			handleError("User is already in attendees list!", 400)
+		requestLogger(r).Info("user registered", logging.UserID(userID), logging.CreatorID(creatorID),
+			"creation_timestamp", creationTimestamp, "waitlisted", registration.Waitlisted)
+		if registration.Waitlisted {
+			metrics.Registrations.WithLabelValues(metrics.OutcomeWaitlisted).Inc()
+			writeJSON(w, r, http.StatusAccepted, map[string]interface{}{
+				"message":  "Workshop is full, added to the waitlist.",
+				"Position": registration.Position,
+			})
 			return
 		}
-		//IF THERE IS VACANCY, add the user to attendee list, and decrement vacancy
-		if vacancies == 0 {
-			handleError("There is 0 vacancy!", 500)
+		metrics.Registrations.WithLabelValues(metrics.OutcomeAttendee).Inc()
+		writeJSON(w, r, http.StatusOK, map[string]string{"message": "Registration successful!"})
+	}
+}
+
+func withdraw(workshops store.WorkshopStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		//get the partition and sort key from the url
+		creatorID, creationTimestamp, err := workshopKey(workshops, r)
+		if err != nil {
+			writeError(w, r, err)
 			return
-		} else {
-			attendees = append(attendees, userID)
-			vacancies -= 1
-		}
-		// Convert the list of attendees to a list of DynamoDB AttributeValues
-		attendeesAttributeValues := make([]*dynamodb.AttributeValue, len(attendees))
-		for i, uid := range attendees {
-			attendeesAttributeValues[i] = &dynamodb.AttributeValue{
-				S: aws.String(uid),
-			}
 		}
-		// Define the update expression and attribute values to send to dynamoDB, the buggering database who designed this
-		updateExpression := "SET Attendees = :value1, Vacancies = :value2"
-		expressionAttributeValues := map[string]*dynamodb.AttributeValue{
-			":value1": {
-				L: attendeesAttributeValues,
-			},
-			":value2": {
-				N: aws.String(strconv.Itoa(vacancies)),
-			},
-		}
-		// Specify the update input.
-		updateInput := &dynamodb.UpdateItemInput{
-			TableName:                 aws.String(tableName),
-			Key:                       key,
-			UpdateExpression:          aws.String(updateExpression),
-			ExpressionAttributeValues: expressionAttributeValues,
-		}
-		// Execute the update operation.
-		_, err = svc.UpdateItem(updateInput)
+		userID, err := userIDFromBody(r)
 		if err != nil {
-			handleError("Error updating the database", 500)
+			writeError(w, r, err)
 			return
 		}
-		resp["message"] = "Registration successful!"
-		w.WriteHeader(200)
-		jsonResponse, _ := json.Marshal(resp)
 
-		if _, err := w.Write(jsonResponse); err != nil {
-			log.Fatalf("Unable to write JSON: %s", err)
+		_, err = workshops.Withdraw(r.Context(), creatorID, creationTimestamp, userID, ifMatch(r))
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
+		metrics.Withdrawals.Inc()
+		requestLogger(r).Info("user withdrew", logging.UserID(userID), logging.CreatorID(creatorID), "creation_timestamp", creationTimestamp)
+		writeJSON(w, r, http.StatusOK, map[string]string{"message": "Withdrawal successful!"})
 	}
 }
 
-func withdraw(svc *dynamodb.DynamoDB) http.HandlerFunc{
+func waitlist_position(workshops store.WorkshopStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		resp := make(map[string]string)
-		handleError := func(message string, statusCode int) {
-			resp["message"] = message
-			w.WriteHeader(statusCode)
-			jsonResponse, _ := json.Marshal(resp)
-
-			if _, err := w.Write(jsonResponse); err != nil {
-				log.Fatalf("Unable to write JSON: %s", err)
-				return
-			}
+		//get the user from the url
+		userID := mux.Vars(r)["user_id"]
+
+		workshop, err := getWorkshop(workshops, r)
+		if err != nil {
+			writeError(w, r, err)
+			return
 		}
-		//get the partition and sort key from the url and parse it into key
-		vars := mux.Vars(r)
-		creatorID := vars["creator_id"]
-		creationTimestamp := vars["creation_timestamp"]
-		key := map[string]*dynamodb.AttributeValue{
-			"Creator_Id": {
-				S: aws.String(creatorID),
-			},
-			"Creation_Timestamp": {
-				S: aws.String(creationTimestamp),
-			},
-		}
-		// Extract userID from the JSON request body
-		var requestBody map[string]interface{}
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&requestBody); err != nil {
-			handleError("Invalid Request Data.", 400)
+		// a place on the waitlist is for the user and the workshop's creator to see
+		c := callerOf(r)
+		if _, err := c.actFor(userID); err != nil && c.mayManage(workshop.Creator_Id) != nil {
+			writeError(w, r, err)
 			return
 		}
-		var userID string
-		if user_id, ok := requestBody["User_Id"].(string); ok {
-			userID = user_id
-		} else {
-			handleError("User_Id given is not a string!", 400)
+		index := funk.IndexOf(workshop.Waitlist, userID)
+		if index == -1 {
+			// the user is what cannot be found here
+			writeProblem(w, r, http.StatusNotFound, store.ErrNotWaitlisted)
 			return
 		}
-		//get the attendees and vacancy of the current workshop
-		var attendeesAndVacancy helpers.AttendeesAndVacancy
-		attendeesAndVacancy, err := helpers.GetAttendeesAndVacancy(creatorID, creationTimestamp, svc, tableName)
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{
+			"User_Id":  userID,
+			"Position": index + 1,
+		})
+	}
+}
+
+func leave_waitlist(workshops store.WorkshopStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		//get the partition and sort key from the url
+		creatorID, creationTimestamp, err := workshopKey(workshops, r)
 		if err != nil {
-			errorMessage := err.Error()
-			if errorMessage == "Workshop not found." {
-				handleError(errorMessage, 404)
-			} else {
-				handleError(errorMessage, 500)
-			}
+			writeError(w, r, err)
 			return
 		}
-		//IF userID is in the attendees list, remove userID from attendee list, and increment vacancy
-		attendees := attendeesAndVacancy.Attendees
-		vacancies := attendeesAndVacancy.Vacancies
-		if funk.Contains(attendees, userID) {
-			index := funk.IndexOf(attendees, userID)
-			newAttendees, err := helpers.RemoveFromList(attendees, index)
-			if err != nil {
-				handleError(err.Error(), 400)
-				return
-			}
-			attendees = newAttendees
-			vacancies += 1
-		} else {
-			handleError("UserID not found in the attendees list!", 400)
+		userID, err := userIDFromBody(r)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
 
-		// Convert the list of attendees to a list of DynamoDB AttributeValues
-		attendeesAttributeValues := make([]*dynamodb.AttributeValue, len(attendees))
-		for i, uid := range attendees {
-			attendeesAttributeValues[i] = &dynamodb.AttributeValue{
-				S: aws.String(uid),
-			}
+		if err := workshops.LeaveWaitlist(r.Context(), creatorID, creationTimestamp, userID, ifMatch(r)); err != nil {
+			writeError(w, r, err)
+			return
 		}
-		// Define the update expression and attribute values to send to dynamoDB, the buggering database who designed this
-		updateExpression := "SET Attendees = :value1, Vacancies = :value2"
-		expressionAttributeValues := map[string]*dynamodb.AttributeValue{
-			":value1": {
-				L: attendeesAttributeValues,
-			},
-			":value2": {
-				N: aws.String(strconv.Itoa(vacancies)),
-			},
-		}
-		// Specify the update input.
-		updateInput := &dynamodb.UpdateItemInput{
-			TableName:                 aws.String(tableName),
-			Key:                       key,
-			UpdateExpression:          aws.String(updateExpression),
-			ExpressionAttributeValues: expressionAttributeValues,
-		}
-		// Execute the update operation.
-		_, err = svc.UpdateItem(updateInput)
-		if err != nil {
-			handleError("Error updating the database", 500)
+		requestLogger(r).Info("user left the waitlist", logging.UserID(userID), logging.CreatorID(creatorID), "creation_timestamp", creationTimestamp)
+		writeJSON(w, r, http.StatusOK, map[string]string{"message": "Left the waitlist."})
+	}
+}
+
+func get_registrations(workshops store.WorkshopStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["user_id"]
+		// users only get to see their own registrations
+		if _, err := callerOf(r).actFor(userID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		// optionally narrow down to seats or waitlist entries
+		status := r.URL.Query().Get("status")
+		if status != "" && status != models.RegistrationStatusRegistered && status != models.RegistrationStatusWaitlisted {
+			writeError(w, r, invalidField("status", "status must be registered or waitlisted"))
 			return
 		}
-		resp["message"] = "Withdrawal successful!"
-		w.WriteHeader(200)
-		jsonResponse, _ := json.Marshal(resp)
 
-		if _, err := w.Write(jsonResponse); err != nil {
-			log.Fatalf("Unable to write JSON: %s", err)
+		registrations, err := workshops.ListRegistrations(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
+		if status != "" {
+			registrations = funk.Filter(registrations, func(registration models.Registration) bool {
+				return registration.Status == status
+			}).([]models.Registration)
+		}
+
+		writeJSON(w, r, http.StatusOK, registrations)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Serve runs server on l until ctx is done, then stops accepting connections
+// and gives the requests in flight up to drain to finish. Requests still
+// running after that are cut off, which cancels their contexts and with them
+// any store calls they are waiting on.
+func Serve(ctx context.Context, server *http.Server, l net.Listener, drain time.Duration) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(l)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return err
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"net/http"
+	"workshop/models"
+)
+
+// workshopTimeZone is the tz query value that renders each workshop in its
+// own Time_Zone.
+const workshopTimeZone = "workshop"
+
+var errInvalidTimeZone = invalidField("tz", "tz must be \"workshop\" or an IANA time zone name")
+
+// parseRenderZone reads the optional tz query parameter and returns how
+// workshops should be rendered in the response. Without it, times are sent
+// as stored, in UTC.
+func parseRenderZone(r *http.Request) (func(models.Workshop) models.Workshop, error) {
+	tz := r.URL.Query().Get("tz")
+	switch tz {
+	case "":
+		return func(workshop models.Workshop) models.Workshop { return workshop }, nil
+	case workshopTimeZone:
+		return func(workshop models.Workshop) models.Workshop {
+			loc, err := workshop.TimeZone()
+			if err != nil {
+				return workshop
+			}
+			return workshop.InTimeZone(loc)
+		}, nil
+	}
+	loc, err := models.LoadTimeZone(tz)
+	if err != nil {
+		return nil, errInvalidTimeZone
+	}
+	return func(workshop models.Workshop) models.Workshop { return workshop.InTimeZone(loc) }, nil
+}
+
+// renderAll renders every workshop of a listing with render.
+func renderAll(workshops []models.Workshop, render func(models.Workshop) models.Workshop) []models.Workshop {
+	rendered := make([]models.Workshop, len(workshops))
+	for i, workshop := range workshops {
+		rendered[i] = render(workshop)
+	}
+	return rendered
+}
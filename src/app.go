@@ -1,60 +1,236 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"flag"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	// "workshop/helpers"
+	"workshop/auth"
+	"workshop/config"
+	"workshop/credentials"
+	"workshop/events"
+	"workshop/health"
+	"workshop/idempotency"
+	"workshop/logging"
+	"workshop/notify"
+	"workshop/ratelimit"
 	"workshop/routes"
+	"workshop/store"
+	"workshop/tracing"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gorilla/mux"
 )
 
-var svc *dynamodb.DynamoDB
-var tableName = "workshop"
+// readinessCacheTTL is how long a readiness report is reused, so probes from
+// every load balancer target group do not each call DescribeTable.
+const readinessCacheTTL = 5 * time.Second
 
 func main() {
-	// var getKeyResult helpers.AWSCredentials
-	// getKeyResult, err := helpers.GetAccessKeys()
-	// if err != nil {
-	// 	log.Println("Error getting access keys")
-	// 	log.Fatal(err)
-	// }
-
-	AKID := ""
-	SECRET_KEY := ""
-	// AKID := getKeyResult.AWSAccessKeyID
-	// SECRET_KEY := getKeyResult.AWSSecretAccessKey
-
-	log.Println("Here is the AKID")
-	log.Println(AKID)
-	log.Println("Here is the SECRET_KEY")
-	log.Println(SECRET_KEY)
+	migrateTimestamps := flag.Bool("migrate-timestamps", false, "rewrite workshops stored with legacy Singapore time timestamps as UTC RFC 3339, then exit")
+	flag.Parse()
 
-	// Initialize a session
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String("ap-southeast-1"),
-		Credentials: credentials.NewStaticCredentials(AKID, SECRET_KEY, ""),
-	})
+	// nothing logged from here on may reveal a secret. The level is only
+	// known once the configuration is loaded.
+	level := new(slog.LevelVar)
+	slog.SetDefault(logging.New(credentials.RedactingWriter(os.Stderr), level))
+
+	cfg, err := config.Load()
 	if err != nil {
-		log.Println("Error getting session:")
-		log.Fatal(err)
+		fatal("invalid configuration", "error", err.Error())
 	}
-	fmt.Println("After creating session")
+	level.Set(logging.ParseLevel(cfg.LogLevel))
 
-	// Create DynamoDB client and expose HTTP requests/responses
-	svc = dynamodb.New(sess, aws.NewConfig().WithLogLevel(aws.LogDebugWithHTTPBody))
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		fatal("could not set up tracing", "error", err.Error())
+	}
+
+	workshops := newStore(cfg)
+	// the migration only moves workshops, so it runs before the store is
+	// given an outbox to record events in
+	if *migrateTimestamps {
+		migrated, err := store.MigrateLegacyTimestamps(context.Background(), store.NewTracedStore(workshops))
+		if err != nil {
+			fatal("migrating timestamps failed", "migrated", migrated, "error", err.Error())
+		}
+		slog.Info("migrated timestamps", "migrated", migrated)
+		shutdownTracing(context.Background())
+		return
+	}
+	checks := healthChecks(workshops)
+	outbox, outboxChecks := newOutbox(cfg, workshops, newNotices(cfg))
+	checks = append(checks, outboxChecks...)
+	keys, idempotencyChecks := newIdempotencyKeys(cfg, workshops)
+	checks = append(checks, idempotencyChecks...)
+	workshops = store.NewTracedStore(workshops)
+
+	authenticator := newAuthenticator(cfg)
 
 	//routes
 	r := mux.NewRouter()
-	routes.RegisterRoutes(r, svc, tableName)
+	routes.RegisterRoutes(r, workshops, routes.Options{
+		Authenticator: authenticator,
+		Limits:        ratelimit.New(cfg.RateLimits),
+		Keys:          keys,
+	})
+	routes.RegisterHealthRoutes(r, health.NewChecker(readinessCacheTTL, checks...))
+	routes.RegisterMetricsRoutes(r)
+
+	server := &http.Server{
+		Addr:         cfg.Addr(),
+		Handler:      routes.Middleware(r),
+		ReadTimeout:  cfg.Timeouts.Read,
+		WriteTimeout: cfg.Timeouts.Write,
+		IdleTimeout:  cfg.Timeouts.Idle,
+	}
+	l, err := net.Listen("tcp", cfg.Addr())
+	if err != nil {
+		fatal("could not listen", "addr", cfg.Addr(), "error", err.Error())
+	}
 
-	if http.ListenAndServe(":8080", r) != nil {
-		log.Fatalf("Failed to create server at port 8080")
+	// ECS sends SIGTERM before stopping the task; Ctrl-C sends SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go outbox.Run(ctx)
+	slog.Info("listening", "addr", l.Addr().String())
+	serveErr := routes.Serve(ctx, server, l, cfg.Timeouts.Shutdown)
+
+	// send the events, notices and spans of the last requests on their way
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := outbox.Flush(flushCtx); err != nil {
+		slog.Warn("could not relay the last events", "error", err.Error())
+	}
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("could not flush traces", "error", err.Error())
 	}
+	if serveErr != nil {
+		stop()
+		cancel()
+		fatal("server stopped", "error", serveErr.Error())
+	}
+	slog.Info("server stopped")
+}
+
+// newStore picks the workshop store. Setting WORKSHOP_STORE=memory runs the
+// service without AWS, which is handy for local development.
+func newStore(cfg config.Config) store.WorkshopStore {
+	if cfg.Store == config.StoreMemory {
+		slog.Info("using the in-memory workshop store")
+		return store.NewMemoryStore()
+	}
+
+	awsConfig := cfg.AWSConfig()
+	creds, err := credentials.New(context.Background(), cfg)
+	if err != nil {
+		fatal("could not get AWS credentials", "error", err.Error())
+	}
+	if creds != nil {
+		awsConfig = awsConfig.WithCredentials(creds)
+	}
+
+	// Initialize a session
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		fatal("could not create an AWS session", "error", err.Error())
+	}
+
+	// Create DynamoDB client
+	svc := dynamodb.New(sess)
+
+	return store.NewDynamoStore(svc, store.DynamoTables{
+		Workshops:         cfg.Tables.Workshops,
+		WorkshopIdIndex:   cfg.Tables.WorkshopIdIndex,
+		CreatorStartIndex: cfg.Tables.CreatorStartIndex,
+		Registrations:     cfg.Tables.Registrations,
+	})
+}
+
+// healthChecks lists the dependencies the service is not ready without. The
+// in-memory store has none.
+func healthChecks(workshops store.WorkshopStore) []health.Check {
+	if dynamoStore, ok := workshops.(*store.DynamoStore); ok {
+		return dynamoStore.HealthChecks()
+	}
+	return nil
+}
+
+// newOutbox has the store record the events of every change in an outbox,
+// and sets up the relay from there to the notices and, when events are
+// turned on, to RabbitMQ, along with the checks for it. The outbox is kept in
+// DynamoDB next to the workshops, or in memory with the in-memory store.
+func newOutbox(cfg config.Config, workshops store.WorkshopStore, notices *notify.Dispatcher) (*events.Outbox, []health.Check) {
+	publishers := []events.Publisher{notices}
+	var checks []health.Check
+	if cfg.Events.Publisher == config.EventsRabbitMQ {
+		// the configuration has already checked the URL
+		if u, _ := url.Parse(cfg.Events.RabbitMQURL); u.User != nil {
+			if password, ok := u.User.Password(); ok {
+				credentials.Register(password)
+			}
+		}
+		broker := events.NewRabbitMQ(cfg.Events.RabbitMQURL, cfg.Events.Exchange)
+		publishers = append(publishers, broker)
+		checks = append(checks, broker.HealthCheck())
+	}
+	relay := events.NewFanout(publishers...)
+	if dynamoStore, ok := workshops.(*store.DynamoStore); ok {
+		outboxStore := dynamoStore.Outbox(cfg.Events.OutboxTable)
+		return events.NewOutbox(outboxStore, relay), append(checks, outboxStore.HealthCheck())
+	}
+	if cfg.Events.Publisher == config.EventsRabbitMQ {
+		slog.Warn("events are kept in memory until RabbitMQ takes them, and are lost on restart")
+	}
+	return events.NewOutbox(workshops.(*store.MemoryStore).Outbox(), relay), checks
+}
+
+// newIdempotencyKeys sets up where the responses to requests with an
+// Idempotency-Key are kept, along with the checks for it: in DynamoDB next to
+// the workshops, or in memory with the in-memory store.
+func newIdempotencyKeys(cfg config.Config, workshops store.WorkshopStore) (*idempotency.Keys, []health.Check) {
+	if dynamoStore, ok := workshops.(*store.DynamoStore); ok {
+		keyStore := dynamoStore.Idempotency(cfg.Idempotency.Table)
+		return idempotency.New(keyStore, cfg.Idempotency.TTL), []health.Check{keyStore.HealthCheck()}
+	}
+	return idempotency.New(store.NewMemoryIdempotency(), cfg.Idempotency.TTL), nil
+}
+
+// newAuthenticator checks the callers' bearer tokens, or returns nil when
+// authentication is turned off.
+func newAuthenticator(cfg config.Config) *auth.Authenticator {
+	if cfg.Auth.Mode == config.AuthNone {
+		slog.Warn("authentication is off, so anyone may act for any user or workshop")
+		return nil
+	}
+	credentials.Register(cfg.Auth.Secret)
+	authenticator, err := auth.New(cfg.Auth)
+	if err != nil {
+		fatal("could not set up authentication", "error", err.Error())
+	}
+	return authenticator
+}
+
+// newNotices sets up how users are told about their workshops being
+// cancelled, from the events the outbox relays.
+func newNotices(cfg config.Config) *notify.Dispatcher {
+	credentials.Register(cfg.Notifications.SMTPPassword, cfg.Notifications.WebhookSecret)
+	if cfg.Notifications.Notifier == config.NotifierLog {
+		slog.Warn("notices to users are only logged, not sent")
+	}
+	return notify.NewDispatcher(notify.New(cfg.Notifications), cfg.Notifications.Timeout)
+}
+
+// fatal logs msg as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+
+	"workshop/events"
+	"workshop/models"
+)
+
+// announcement describes a change as the events it makes, given the workshop
+// before and after it. Both stores record the events in their outbox in the
+// same atomic step as the change, so a change is never made without them.
+type announcement func(before models.Workshop, after models.Workshop) []events.Event
+
+// unannouncedKey marks a context whose changes are made without events.
+type unannouncedKey struct{}
+
+// unannounced has the stores make the changes under ctx without recording
+// any events, for maintenance that changes how workshops are stored but not
+// the workshops themselves.
+func unannounced(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unannouncedKey{}, true)
+}
+
+// isUnannounced reports whether changes under ctx are made without events.
+func isUnannounced(ctx context.Context) bool {
+	quiet, _ := ctx.Value(unannouncedKey{}).(bool)
+	return quiet
+}
+
+// announced announces a change with one event about the changed workshop.
+func announced(event func(workshop models.Workshop) events.Event) announcement {
+	return func(before models.Workshop, after models.Workshop) []events.Event {
+		return []events.Event{event(after)}
+	}
+}
+
+// deleted announces that the workshop before is gone.
+func deleted(before models.Workshop, after models.Workshop) []events.Event {
+	return []events.Event{events.WorkshopDeleted(before)}
+}
+
+// registered announces where the user a register mutation took ended up.
+func registered(userID string, result *RegisterResult) announcement {
+	return func(before models.Workshop, after models.Workshop) []events.Event {
+		return []events.Event{events.AttendeeRegistered(after.Workshop_Id, after.Creator_Id, after.Creation_Timestamp, userID, result.Waitlisted)}
+	}
+}
+
+// withdrew announces a withdrawal, along with the promotion of whoever took
+// the freed seat.
+func withdrew(userID string, result *WithdrawResult) announcement {
+	return func(before models.Workshop, after models.Workshop) []events.Event {
+		recorded := []events.Event{events.AttendeeWithdrew(after.Workshop_Id, after.Creator_Id, after.Creation_Timestamp, userID, false)}
+		if result.Promoted != "" {
+			recorded = append(recorded, events.AttendeePromoted(after.Workshop_Id, after.Creator_Id, after.Creation_Timestamp, result.Promoted))
+		}
+		return recorded
+	}
+}
+
+// leftWaitlist announces that userID withdrew from the waitlist.
+func leftWaitlist(userID string) announcement {
+	return func(before models.Workshop, after models.Workshop) []events.Event {
+		return []events.Event{events.AttendeeWithdrew(after.Workshop_Id, after.Creator_Id, after.Creation_Timestamp, userID, true)}
+	}
+}
+
+// patched announces a patch, along with the promotion of everyone who moved
+// off the waitlist into the seats it added.
+func patched(promoted *[]string) announcement {
+	return func(before models.Workshop, after models.Workshop) []events.Event {
+		recorded := []events.Event{events.WorkshopUpdated(after)}
+		for _, userID := range *promoted {
+			recorded = append(recorded, events.AttendeePromoted(after.Workshop_Id, after.Creator_Id, after.Creation_Timestamp, userID))
+		}
+		return recorded
+	}
+}
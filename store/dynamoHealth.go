@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"workshop/health"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// HealthChecks describes each table the store uses. A check fails when the
+// table is missing or not serving, or when the credentials do not allow
+// reading its description.
+func (s *DynamoStore) HealthChecks() []health.Check {
+	return []health.Check{
+		{
+			Name: "dynamodb:" + s.tables.Workshops,
+			Run: func(ctx context.Context) error {
+				return checkTable(ctx, s.svc, s.tables.Workshops, s.tables.WorkshopIdIndex, s.tables.CreatorStartIndex)
+			},
+		},
+		{
+			Name: "dynamodb:" + s.tables.Registrations,
+			Run: func(ctx context.Context) error {
+				return checkTable(ctx, s.svc, s.tables.Registrations)
+			},
+		},
+	}
+}
+
+// checkTable makes sure the table, and each of the named indexes, can serve
+// reads and writes.
+func checkTable(ctx context.Context, svc *dynamodb.DynamoDB, table string, indexes ...string) error {
+	result, err := svc.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return err
+	}
+	if status := aws.StringValue(result.Table.TableStatus); !isServing(status) {
+		return fmt.Errorf("table %s is %s", table, status)
+	}
+	for _, index := range indexes {
+		if err := checkIndex(result.Table, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkIndex(table *dynamodb.TableDescription, index string) error {
+	for _, gsi := range table.GlobalSecondaryIndexes {
+		if aws.StringValue(gsi.IndexName) != index {
+			continue
+		}
+		if status := aws.StringValue(gsi.IndexStatus); !isServing(status) {
+			return fmt.Errorf("index %s of table %s is %s", index, aws.StringValue(table.TableName), status)
+		}
+		return nil
+	}
+	return fmt.Errorf("table %s has no index %s", aws.StringValue(table.TableName), index)
+}
+
+// isServing reports whether a table or index in this status takes requests.
+func isServing(status string) bool {
+	return status == dynamodb.TableStatusActive || status == dynamodb.TableStatusUpdating
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"workshop/health"
+	"workshop/idempotency"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// idempotencyItem is the layout of a record in the idempotency table, which
+// is keyed by Idempotency_Key alone. Turn on DynamoDB's time to live on
+// Expires_At, in seconds since the epoch, so old records are deleted.
+type idempotencyItem struct {
+	Idempotency_Key string
+	Fingerprint     string
+	Done            bool
+	Status          int               `dynamodbav:",omitempty"`
+	Header          map[string]string `dynamodbav:",omitempty"`
+	Body            []byte            `dynamodbav:",omitempty"`
+	Expires_At      int64
+}
+
+// DynamoIdempotency is an idempotency.Store kept in a DynamoDB table.
+type DynamoIdempotency struct {
+	svc   *dynamodb.DynamoDB
+	table string
+}
+
+// Idempotency returns an idempotency store kept in table, using the same
+// client as s.
+func (s *DynamoStore) Idempotency(table string) *DynamoIdempotency {
+	return &DynamoIdempotency{svc: s.svc, table: table}
+}
+
+func (d *DynamoIdempotency) key(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"Idempotency_Key": {
+			S: aws.String(key),
+		},
+	}
+}
+
+// Claim puts the record unless an unexpired one has its key. DynamoDB only
+// deletes expired items eventually, so they are overwritten here.
+func (d *DynamoIdempotency) Claim(ctx context.Context, record idempotency.Record) (*idempotency.Record, error) {
+	av, err := dynamodbattribute.MarshalMap(toIdempotencyItem(record))
+	if err != nil {
+		return nil, err
+	}
+	_, err = d.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.table),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(Idempotency_Key) OR Expires_At <= :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {
+				N: aws.String(strconv.FormatInt(time.Now().Unix(), 10)),
+			},
+		},
+	})
+	if err == nil {
+		return nil, nil
+	}
+	if !isConditionalCheckFailed(err) {
+		return nil, err
+	}
+	result, err := d.svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            d.key(record.Key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		// released in between; the client may simply retry
+		return nil, errors.New("idempotency key was released while being claimed")
+	}
+	var item idempotencyItem
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &item); err != nil {
+		return nil, err
+	}
+	existing := item.record()
+	return &existing, nil
+}
+
+func (d *DynamoIdempotency) Save(ctx context.Context, record idempotency.Record) error {
+	av, err := dynamodbattribute.MarshalMap(toIdempotencyItem(record))
+	if err != nil {
+		return err
+	}
+	_, err = d.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item:      av,
+	})
+	return err
+}
+
+func (d *DynamoIdempotency) Release(ctx context.Context, key string) error {
+	_, err := d.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key:       d.key(key),
+	})
+	return err
+}
+
+// HealthCheck fails when the idempotency table is missing or not serving, as
+// requests with an Idempotency-Key could not be served then.
+func (d *DynamoIdempotency) HealthCheck() health.Check {
+	return health.Check{
+		Name: "dynamodb:" + d.table,
+		Run: func(ctx context.Context) error {
+			return checkTable(ctx, d.svc, d.table)
+		},
+	}
+}
+
+func toIdempotencyItem(record idempotency.Record) idempotencyItem {
+	return idempotencyItem{
+		Idempotency_Key: record.Key,
+		Fingerprint:     record.Fingerprint,
+		Done:            record.Done,
+		Status:          record.Response.Status,
+		Header:          record.Response.Header,
+		Body:            record.Response.Body,
+		// rounded up, so a record never expires early
+		Expires_At: record.Expires_At.Add(time.Second - 1).Unix(),
+	}
+}
+
+func (item idempotencyItem) record() idempotency.Record {
+	return idempotency.Record{
+		Key:         item.Idempotency_Key,
+		Fingerprint: item.Fingerprint,
+		Done:        item.Done,
+		Response: idempotency.Response{
+			Status: item.Status,
+			Header: item.Header,
+			Body:   item.Body,
+		},
+		Expires_At: time.Unix(item.Expires_At, 0),
+	}
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"workshop/events"
+	"workshop/health"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+const (
+	// outboxPartition is the partition key every outbox item shares, so the
+	// pending events can be read back in order with a single Query. The
+	// outbox only holds events the broker has not taken yet, so it stays
+	// small.
+	outboxPartition = "events"
+	// outboxSequenceLayout has a fixed width, so sequences sort by time
+	outboxSequenceLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+// outboxItem is the layout of an event in the outbox table, which is keyed
+// by Outbox (partition key) and Sequence (sort key).
+type outboxItem struct {
+	Outbox   string
+	Sequence string
+	Event_Id string
+	Type     string
+	// Event is the event as JSON
+	Event string
+}
+
+// DynamoOutbox is an events.OutboxStore kept in a DynamoDB table, which a
+// DynamoStore records its events in.
+type DynamoOutbox struct {
+	svc      *dynamodb.DynamoDB
+	table    string
+	recorded chan struct{}
+}
+
+// Outbox has s record the events of every change in table, in the same
+// transaction as the change, and returns the outbox to relay them from. It
+// is called once, before s is put to use.
+func (s *DynamoStore) Outbox(table string) *DynamoOutbox {
+	s.outbox = &DynamoOutbox{svc: s.svc, table: table, recorded: make(chan struct{}, 1)}
+	return s.outbox
+}
+
+func (o *DynamoOutbox) key(event events.Event) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"Outbox": {
+			S: aws.String(outboxPartition),
+		},
+		"Sequence": {
+			S: aws.String(outboxSequence(event)),
+		},
+	}
+}
+
+// outboxSequence orders events by when they occurred; the Event_Id breaks
+// ties.
+func outboxSequence(event events.Event) string {
+	return event.Occurred_At.UTC().Format(outboxSequenceLayout) + "#" + event.Event_Id
+}
+
+// writes turns the events into transaction items, for the DynamoStore to
+// write along with the change they describe.
+func (o *DynamoOutbox) writes(recorded []events.Event) ([]*dynamodb.TransactWriteItem, error) {
+	writes := []*dynamodb.TransactWriteItem{}
+	for _, event := range recorded {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		av, err := dynamodbattribute.MarshalMap(outboxItem{
+			Outbox:   outboxPartition,
+			Sequence: outboxSequence(event),
+			Event_Id: event.Event_Id,
+			Type:     event.Type,
+			Event:    string(body),
+		})
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName: aws.String(o.table),
+				Item:      av,
+			},
+		})
+	}
+	return writes, nil
+}
+
+// wake tells the relay that events were recorded. Events recorded by other
+// instances are only picked up on the relay's next retry.
+func (o *DynamoOutbox) wake() {
+	select {
+	case o.recorded <- struct{}{}:
+	default:
+	}
+}
+
+func (o *DynamoOutbox) Recorded() <-chan struct{} {
+	return o.recorded
+}
+
+func (o *DynamoOutbox) Pending(ctx context.Context, limit int) ([]events.Event, error) {
+	result, err := o.svc.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(o.table),
+		KeyConditionExpression: aws.String("Outbox = :val"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":val": {
+				S: aws.String(outboxPartition),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+		Limit:          aws.Int64(int64(limit)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	pending := []events.Event{}
+	for _, i := range result.Items {
+		var item outboxItem
+		if err := dynamodbattribute.UnmarshalMap(i, &item); err != nil {
+			return nil, err
+		}
+		var event events.Event
+		if err := json.Unmarshal([]byte(item.Event), &event); err != nil {
+			return nil, err
+		}
+		pending = append(pending, event)
+	}
+	return pending, nil
+}
+
+func (o *DynamoOutbox) Remove(ctx context.Context, event events.Event) error {
+	_, err := o.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(o.table),
+		Key:       o.key(event),
+	})
+	return err
+}
+
+// HealthCheck fails when the outbox table is missing or not serving, as
+// events could not be recorded then.
+func (o *DynamoOutbox) HealthCheck() health.Check {
+	return health.Check{
+		Name: "dynamodb:" + o.table,
+		Run: func(ctx context.Context) error {
+			return checkTable(ctx, o.svc, o.table)
+		},
+	}
+}
@@ -0,0 +1,659 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"workshop/events"
+	"workshop/metrics"
+	"workshop/models"
+	"workshop/tracing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// maxWriteAttempts bounds how often a conditional write is retried after
+// losing a race with another writer.
+const maxWriteAttempts = 3
+
+// batchWriteSize is the most items BatchWriteItem accepts in one call.
+const batchWriteSize = 25
+
+// maxBatchAttempts bounds how often BatchWriteItem is called in a row for
+// writes it keeps leaving unprocessed.
+const maxBatchAttempts = 5
+
+// retryBackoff is the most the first retry of a write waits. Each retry
+// after that waits up to twice as long as the one before.
+const retryBackoff = 20 * time.Millisecond
+
+// maxTransactItems is the most items TransactWriteItems accepts in one call.
+const maxTransactItems = 100
+
+// DynamoTables names the tables and indexes a DynamoStore works with.
+type DynamoTables struct {
+	// Workshops is keyed by Creator_Id (partition key) and Creation_Timestamp
+	// (sort key)
+	Workshops string
+	// WorkshopIdIndex is a global secondary index on Workshops with
+	// Workshop_Id as its partition key
+	WorkshopIdIndex string
+	// CreatorStartIndex is a global secondary index on Workshops with
+	// Creator_Id as its partition key and Start_Timestamp as its sort key,
+	// projecting every attribute. A creator's workshops are listed in start
+	// order from it.
+	CreatorStartIndex string
+	// Registrations is keyed by User_Id (partition key) and Workshop_Key
+	// (sort key)
+	Registrations string
+}
+
+// DynamoStore keeps workshops in DynamoDB. Registration records live in a
+// table of their own and are written in the same transaction as the workshop,
+// as are the events of the change when there is an outbox. A change that
+// does not fit in one transaction fails with ErrTooManyChanges, except for
+// deleting a workshop.
+type DynamoStore struct {
+	svc    *dynamodb.DynamoDB
+	tables DynamoTables
+	// outbox, when set, records the events of every change
+	outbox *DynamoOutbox
+}
+
+// NewDynamoStore also makes svc report its calls to the metrics and record
+// a span for each of them.
+func NewDynamoStore(svc *dynamodb.DynamoDB, tables DynamoTables) *DynamoStore {
+	if !svc.Handlers.Validate.SwapNamed(tracing.DynamoDBStartHandler) {
+		svc.Handlers.Validate.PushFrontNamed(tracing.DynamoDBStartHandler)
+	}
+	for _, handler := range []request.NamedHandler{metrics.DynamoDBHandler, tracing.DynamoDBEndHandler} {
+		if !svc.Handlers.Complete.SwapNamed(handler) {
+			svc.Handlers.Complete.PushBackNamed(handler)
+		}
+	}
+	return &DynamoStore{svc: svc, tables: tables}
+}
+
+// registrationItem is the layout of a registration record in the
+// registrations table.
+type registrationItem struct {
+	User_Id                string
+	Workshop_Key           string
+	Workshop_Id            string
+	Creator_Id             string
+	Creation_Timestamp     string
+	Status                 string
+	Registration_Timestamp string
+}
+
+func (s *DynamoStore) registrationKey(registration models.Registration) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"User_Id": {
+			S: aws.String(registration.User_Id),
+		},
+		"Workshop_Key": {
+			S: aws.String(registrationKey(registration)),
+		},
+	}
+}
+
+// registrationWrites turns the registration changes between before and after
+// into write requests.
+func (s *DynamoStore) registrationWrites(before models.Workshop, after models.Workshop) ([]*dynamodb.WriteRequest, error) {
+	puts, deletes := registrationChanges(before, after, time.Now())
+	writes := []*dynamodb.WriteRequest{}
+	for _, registration := range puts {
+		av, err := dynamodbattribute.MarshalMap(registrationItem{
+			User_Id:                registration.User_Id,
+			Workshop_Key:           registrationKey(registration),
+			Workshop_Id:            registration.Workshop_Id,
+			Creator_Id:             registration.Creator_Id,
+			Creation_Timestamp:     registration.Creation_Timestamp,
+			Status:                 registration.Status,
+			Registration_Timestamp: registration.Registration_Timestamp,
+		})
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{Item: av},
+		})
+	}
+	for _, registration := range deletes {
+		writes = append(writes, &dynamodb.WriteRequest{
+			DeleteRequest: &dynamodb.DeleteRequest{Key: s.registrationKey(registration)},
+		})
+	}
+	return writes, nil
+}
+
+// registrationTransactItem makes a write request to the registrations table
+// part of a transaction.
+func (s *DynamoStore) registrationTransactItem(write *dynamodb.WriteRequest) *dynamodb.TransactWriteItem {
+	if write.PutRequest != nil {
+		return &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName: aws.String(s.tables.Registrations),
+				Item:      write.PutRequest.Item,
+			},
+		}
+	}
+	return &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			TableName: aws.String(s.tables.Registrations),
+			Key:       write.DeleteRequest.Key,
+		},
+	}
+}
+
+// announce makes the events of a change from before to after, when there is
+// an outbox to record them in and ctx does not leave the change unannounced.
+func (s *DynamoStore) announce(ctx context.Context, announce announcement, before models.Workshop, after models.Workshop) []events.Event {
+	if s.outbox == nil || announce == nil || isUnannounced(ctx) {
+		return nil
+	}
+	return announce(before, after)
+}
+
+func (s *DynamoStore) key(creatorID string, creationTimestamp string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"Creator_Id": {
+			S: aws.String(creatorID),
+		},
+		"Creation_Timestamp": {
+			S: aws.String(creationTimestamp),
+		},
+	}
+}
+
+func unmarshalWorkshops(items []map[string]*dynamodb.AttributeValue) ([]models.Workshop, error) {
+	workshops := []models.Workshop{}
+	for _, i := range items {
+		// Unmarshal DynamoDB JSON format to the workshop model
+		var workshop models.Workshop
+		if err := dynamodbattribute.UnmarshalMap(i, &workshop); err != nil {
+			return nil, err
+		}
+		workshops = append(workshops, workshop)
+	}
+	return workshops, nil
+}
+
+// fetchPage reads one page of a Scan or Query, starting after startKey.
+type fetchPage func(startKey map[string]*dynamodb.AttributeValue) (items []map[string]*dynamodb.AttributeValue, lastKey map[string]*dynamodb.AttributeValue, err error)
+
+// List scans the table, which keeps no order across creators, so sorting
+// fails with ErrSortUnsupported rather than reading every workshop for
+// every page.
+func (s *DynamoStore) List(ctx context.Context, opts ListOptions) (Page, error) {
+	if opts.Sort != "" {
+		return Page{}, ErrSortUnsupported
+	}
+	return s.list(func(startKey map[string]*dynamodb.AttributeValue) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue, error) {
+		input := &dynamodb.ScanInput{
+			TableName:         aws.String(s.tables.Workshops),
+			ExclusiveStartKey: startKey,
+		}
+		result, err := s.svc.ScanWithContext(ctx, input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return result.Items, result.LastEvaluatedKey, nil
+	}, opts)
+}
+
+// ListByCreator queries the creator's workshops, from CreatorStartIndex when
+// they are to be sorted by start time.
+func (s *DynamoStore) ListByCreator(ctx context.Context, creatorID string, opts ListOptions) (Page, error) {
+	return s.list(func(startKey map[string]*dynamodb.AttributeValue) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue, error) {
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(s.tables.Workshops),
+			KeyConditionExpression: aws.String("Creator_Id = :val"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":val": {
+					S: aws.String(creatorID),
+				},
+			},
+			ExclusiveStartKey: startKey,
+		}
+		if opts.Sort != "" {
+			input.IndexName = aws.String(s.tables.CreatorStartIndex)
+			input.ScanIndexForward = aws.Bool(opts.Sort == SortByStart)
+		}
+		result, err := s.svc.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return result.Items, result.LastEvaluatedKey, nil
+	}, opts)
+}
+
+// list keeps fetching pages until it has a full page of matching workshops,
+// so neither the 1 MB response limit nor the filters shorten a page. The next
+// token is the key of the last workshop returned, which DynamoDB accepts as
+// ExclusiveStartKey; a sorted listing reads an index, whose key also holds
+// Start_Timestamp.
+func (s *DynamoStore) list(fetch fetchPage, opts ListOptions) (Page, error) {
+	after, err := decodeCursor(opts.NextToken)
+	if err != nil {
+		return Page{}, err
+	}
+	sorted := opts.Sort != ""
+
+	var startKey map[string]*dynamodb.AttributeValue
+	if after != nil {
+		if after.Creator_Id == "" || after.Creation_Timestamp == "" || sorted && after.Start_Timestamp == "" {
+			return Page{}, ErrInvalidToken
+		}
+		startKey = s.key(after.Creator_Id, after.Creation_Timestamp)
+		if sorted {
+			startKey["Start_Timestamp"] = &dynamodb.AttributeValue{S: aws.String(after.Start_Timestamp)}
+		}
+	}
+	now := time.Now()
+	page := Page{Workshops: []models.Workshop{}}
+	for {
+		items, lastKey, err := fetch(startKey)
+		if err != nil {
+			return Page{}, err
+		}
+		workshops, err := unmarshalWorkshops(items)
+		if err != nil {
+			return Page{}, err
+		}
+		for _, workshop := range workshops {
+			if !opts.matches(workshop, now) {
+				continue
+			}
+			if len(page.Workshops) == opts.limit() {
+				last := page.Workshops[len(page.Workshops)-1]
+				next := cursor{Creator_Id: last.Creator_Id, Creation_Timestamp: last.Creation_Timestamp}
+				if sorted {
+					next.Start_Timestamp = last.Start_Timestamp
+				}
+				page.NextToken = encodeCursor(next)
+				return page, nil
+			}
+			page.Workshops = append(page.Workshops, workshop)
+		}
+		if lastKey == nil {
+			return page, nil
+		}
+		startKey = lastKey
+	}
+}
+
+func (s *DynamoStore) Get(ctx context.Context, creatorID string, creationTimestamp string) (models.Workshop, error) {
+	var workshop models.Workshop
+	input := &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tables.Workshops),
+		Key:            s.key(creatorID, creationTimestamp),
+		ConsistentRead: aws.Bool(true),
+	}
+	result, err := s.svc.GetItemWithContext(ctx, input)
+	if err != nil {
+		return workshop, err
+	} else if result.Item == nil {
+		return workshop, ErrNotFound
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &workshop)
+	return workshop, err
+}
+
+func (s *DynamoStore) GetByID(ctx context.Context, workshopID string) (models.Workshop, error) {
+	// the index is only eventually consistent, so it is used to find the key
+	// and the workshop itself is read from the table
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.tables.Workshops),
+		IndexName:              aws.String(s.tables.WorkshopIdIndex),
+		KeyConditionExpression: aws.String("Workshop_Id = :val"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":val": {
+				S: aws.String(workshopID),
+			},
+		},
+	}
+	result, err := s.svc.QueryWithContext(ctx, input)
+	if err != nil {
+		return models.Workshop{}, err
+	} else if len(result.Items) == 0 {
+		return models.Workshop{}, ErrNotFound
+	}
+	var workshop models.Workshop
+	if err := dynamodbattribute.UnmarshalMap(result.Items[0], &workshop); err != nil {
+		return models.Workshop{}, err
+	}
+	return s.Get(ctx, workshop.Creator_Id, workshop.Creation_Timestamp)
+}
+
+// Put replaces whatever is stored under the workshop's key, so the
+// registration records are brought in line with the workshop it replaces.
+func (s *DynamoStore) Put(ctx context.Context, workshop models.Workshop) error {
+	existing, err := s.Get(ctx, workshop.Creator_Id, workshop.Creation_Timestamp)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return s.write(ctx, existing, workshop, nil, nil, nil)
+}
+
+func (s *DynamoStore) Create(ctx context.Context, workshop models.Workshop) error {
+	recorded := s.announce(ctx, announced(events.WorkshopCreated), models.Workshop{}, workshop)
+	err := s.write(ctx, models.Workshop{}, workshop, aws.String("attribute_not_exists(Creator_Id)"), nil, recorded)
+	if isConditionalCheckFailed(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+// Update goes through mutate like registration does, so a patch never
+// upserts a missing workshop and is validated against the item it replaces.
+func (s *DynamoStore) Update(ctx context.Context, creatorID string, creationTimestamp string, patch models.WorkshopPatch, pre Precondition) (models.Workshop, error) {
+	var promoted []string
+	return s.mutate(ctx, creatorID, creationTimestamp, pre, applyPatch(patch, &promoted), patched(&promoted))
+}
+
+func (s *DynamoStore) Transition(ctx context.Context, creatorID string, creationTimestamp string, status string, pre Precondition) (models.Workshop, error) {
+	return s.mutate(ctx, creatorID, creationTimestamp, pre, transition(status), announced(events.WorkshopStatusChanged))
+}
+
+func (s *DynamoStore) Cancel(ctx context.Context, creatorID string, creationTimestamp string, reason string, pre Precondition) (models.Workshop, error) {
+	return s.mutate(ctx, creatorID, creationTimestamp, pre, cancel(reason), announced(events.WorkshopStatusChanged))
+}
+
+// Delete removes the workshop in one transaction with as many of its
+// registration records as fit. A workshop can have more attendees than that,
+// so the rest of the records are removed first: if that fails, the workshop
+// is still there and deleting it again finishes the job.
+func (s *DynamoStore) Delete(ctx context.Context, creatorID string, creationTimestamp string, pre Precondition) error {
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		if err := backoff(ctx, attempt); err != nil {
+			return err
+		}
+		workshop, err := s.Get(ctx, creatorID, creationTimestamp)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if pre != nil && !pre(workshop.Version) {
+			return ErrPreconditionFailed
+		}
+
+		// only delete the version we read, so no registration slips through
+		condition := aws.String("attribute_not_exists(Version) OR Version = :version")
+		values := map[string]*dynamodb.AttributeValue{
+			":version": {
+				N: aws.String(strconv.FormatInt(workshop.Version, 10)),
+			},
+		}
+		recorded := s.announce(ctx, deleted, workshop, models.Workshop{})
+		deletes, err := s.registrationWrites(workshop, models.Workshop{Creator_Id: creatorID, Creation_Timestamp: creationTimestamp})
+		if err != nil {
+			return err
+		}
+		if room := maxTransactItems - 1 - len(recorded); len(deletes) > room {
+			if err := s.writeRegistrations(ctx, deletes[room:]); err != nil {
+				return err
+			}
+			deletes = deletes[:room]
+		}
+		if len(recorded) == 0 && len(deletes) == 0 {
+			_, err = s.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+				TableName:                 aws.String(s.tables.Workshops),
+				Key:                       s.key(creatorID, creationTimestamp),
+				ConditionExpression:       condition,
+				ExpressionAttributeValues: values,
+			})
+		} else {
+			err = s.transact(ctx, &dynamodb.TransactWriteItem{
+				Delete: &dynamodb.Delete{
+					TableName:                 aws.String(s.tables.Workshops),
+					Key:                       s.key(creatorID, creationTimestamp),
+					ConditionExpression:       condition,
+					ExpressionAttributeValues: values,
+				},
+			}, recorded, deletes)
+		}
+		if isConditionalCheckFailed(err) {
+			continue
+		}
+		return err
+	}
+	return ErrConflict
+}
+
+// writeRegistrations writes registration records in batches, outside any
+// transaction. Throttled writes come back unprocessed and are retried with
+// backoff, up to maxBatchAttempts calls in a row.
+func (s *DynamoStore) writeRegistrations(ctx context.Context, requests []*dynamodb.WriteRequest) error {
+	attempt := 0
+	for len(requests) > 0 {
+		if err := backoff(ctx, attempt); err != nil {
+			return err
+		}
+		batch := requests
+		if len(batch) > batchWriteSize {
+			batch = batch[:batchWriteSize]
+		}
+		result, err := s.svc.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{s.tables.Registrations: batch},
+		})
+		if err != nil {
+			return err
+		}
+		unprocessed := result.UnprocessedItems[s.tables.Registrations]
+		requests = append(unprocessed, requests[len(batch):]...)
+		if len(unprocessed) == 0 {
+			attempt = 0
+			continue
+		}
+		attempt++
+		if attempt == maxBatchAttempts {
+			return fmt.Errorf("writing registration records: %d left unprocessed after %d attempts", len(requests), attempt)
+		}
+	}
+	return nil
+}
+
+// backoff waits before the given retry of a write, or not at all before the
+// first attempt. The wait is random, up to a cap that doubles with every
+// retry, so writers that collided do not collide again.
+func backoff(ctx context.Context, attempt int) error {
+	if attempt == 0 {
+		return ctx.Err()
+	}
+	wait := time.Duration(rand.Int63n(int64(retryBackoff << (attempt - 1))))
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *DynamoStore) ListRegistrations(ctx context.Context, userID string) ([]models.Registration, error) {
+	registrations := []models.Registration{}
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(s.tables.Registrations),
+			KeyConditionExpression: aws.String("User_Id = :val"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":val": {
+					S: aws.String(userID),
+				},
+			},
+			ExclusiveStartKey: startKey,
+		}
+		result, err := s.svc.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range result.Items {
+			var item registrationItem
+			if err := dynamodbattribute.UnmarshalMap(i, &item); err != nil {
+				return nil, err
+			}
+			registrations = append(registrations, models.Registration{
+				User_Id:                item.User_Id,
+				Workshop_Id:            item.Workshop_Id,
+				Creator_Id:             item.Creator_Id,
+				Creation_Timestamp:     item.Creation_Timestamp,
+				Status:                 item.Status,
+				Registration_Timestamp: item.Registration_Timestamp,
+			})
+		}
+		if result.LastEvaluatedKey == nil {
+			return registrations, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+func (s *DynamoStore) Register(ctx context.Context, creatorID string, creationTimestamp string, userID string, joinWaitlist bool, pre Precondition) (RegisterResult, error) {
+	var result RegisterResult
+	_, err := s.mutate(ctx, creatorID, creationTimestamp, pre, register(userID, joinWaitlist, &result), registered(userID, &result))
+	return result, err
+}
+
+func (s *DynamoStore) Withdraw(ctx context.Context, creatorID string, creationTimestamp string, userID string, pre Precondition) (WithdrawResult, error) {
+	var result WithdrawResult
+	_, err := s.mutate(ctx, creatorID, creationTimestamp, pre, withdraw(userID, &result), withdrew(userID, &result))
+	return result, err
+}
+
+func (s *DynamoStore) LeaveWaitlist(ctx context.Context, creatorID string, creationTimestamp string, userID string, pre Precondition) error {
+	_, err := s.mutate(ctx, creatorID, creationTimestamp, pre, leaveWaitlist(userID), leftWaitlist(userID))
+	return err
+}
+
+// mutate reads the workshop, applies fn and writes it back, along with the
+// events announce makes of the change, only if nobody else wrote in between.
+// Lost races are retried a few times before giving up with ErrConflict; pre
+// is checked again on every attempt.
+func (s *DynamoStore) mutate(ctx context.Context, creatorID string, creationTimestamp string, pre Precondition, fn mutation, announce announcement) (models.Workshop, error) {
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		if err := backoff(ctx, attempt); err != nil {
+			return models.Workshop{}, err
+		}
+		workshop, err := s.Get(ctx, creatorID, creationTimestamp)
+		if err != nil {
+			return models.Workshop{}, err
+		}
+		if pre != nil && !pre(workshop.Version) {
+			return models.Workshop{}, ErrPreconditionFailed
+		}
+		before := copyWorkshop(workshop)
+		version := workshop.Version
+		if err := fn(&workshop); err != nil {
+			return models.Workshop{}, err
+		}
+		workshop.Version = version + 1
+
+		err = s.putIfVersion(ctx, before, workshop, version, s.announce(ctx, announce, before, workshop))
+		if isConditionalCheckFailed(err) {
+			continue
+		} else if err != nil {
+			return models.Workshop{}, err
+		}
+		return workshop, nil
+	}
+	return models.Workshop{}, ErrConflict
+}
+
+// putIfVersion replaces an existing workshop as long as its Version is still
+// the one we read. Items written before versioning have no Version at all.
+func (s *DynamoStore) putIfVersion(ctx context.Context, before models.Workshop, after models.Workshop, version int64, recorded []events.Event) error {
+	return s.write(ctx, before, after,
+		aws.String("attribute_exists(Creator_Id) AND (attribute_not_exists(Version) OR Version = :version)"),
+		map[string]*dynamodb.AttributeValue{
+			":version": {
+				N: aws.String(strconv.FormatInt(version, 10)),
+			},
+		}, recorded)
+}
+
+// write puts after in place of before, together with any registration records
+// that change and the events recorded of the change, provided the condition
+// holds. A single PutItem is enough when nothing else is written.
+func (s *DynamoStore) write(ctx context.Context, before models.Workshop, after models.Workshop, condition *string, values map[string]*dynamodb.AttributeValue, recorded []events.Event) error {
+	//marshall the struct into an attribute value object
+	av, err := dynamodbattribute.MarshalMap(after)
+	if err != nil {
+		return err
+	}
+	registrationWrites, err := s.registrationWrites(before, after)
+	if err != nil {
+		return err
+	}
+	if len(registrationWrites) == 0 && len(recorded) == 0 {
+		input := &dynamodb.PutItemInput{
+			Item:                      av,
+			TableName:                 aws.String(s.tables.Workshops),
+			ConditionExpression:       condition,
+			ExpressionAttributeValues: values,
+		}
+		_, err = s.svc.PutItemWithContext(ctx, input)
+		return err
+	}
+	return s.transact(ctx, &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			Item:                      av,
+			TableName:                 aws.String(s.tables.Workshops),
+			ConditionExpression:       condition,
+			ExpressionAttributeValues: values,
+		},
+	}, recorded, registrationWrites)
+}
+
+// transact writes the change to the workshop in one transaction with the
+// events recorded of it and the registration records that change. It fails
+// with ErrTooManyChanges, writing nothing, when they do not fit in
+// maxTransactItems, so the workshop and its records never disagree.
+func (s *DynamoStore) transact(ctx context.Context, change *dynamodb.TransactWriteItem, recorded []events.Event, registrationWrites []*dynamodb.WriteRequest) error {
+	if 1+len(recorded)+len(registrationWrites) > maxTransactItems {
+		return ErrTooManyChanges
+	}
+	items := []*dynamodb.TransactWriteItem{change}
+	if len(recorded) > 0 {
+		outboxWrites, err := s.outbox.writes(recorded)
+		if err != nil {
+			return err
+		}
+		items = append(items, outboxWrites...)
+	}
+	for _, write := range registrationWrites {
+		items = append(items, s.registrationTransactItem(write))
+	}
+	if _, err := s.svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items}); err != nil {
+		return err
+	}
+	if len(recorded) > 0 {
+		s.outbox.wake()
+	}
+	return nil
+}
+
+// isConditionalCheckFailed reports whether a write lost a race, either on its
+// own condition or inside a cancelled transaction.
+func isConditionalCheckFailed(err error) bool {
+	var cancelled *dynamodb.TransactionCanceledException
+	if errors.As(err, &cancelled) {
+		for _, reason := range cancelled.CancellationReasons {
+			if reason.Code != nil && (*reason.Code == "ConditionalCheckFailed" || *reason.Code == "TransactionConflict") {
+				return true
+			}
+		}
+		return false
+	}
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
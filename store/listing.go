@@ -0,0 +1,187 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"workshop/apperrors"
+	"workshop/models"
+
+	"github.com/thoas/go-funk"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 100
+
+	WhenUpcoming = "upcoming"
+	WhenPast     = "past"
+
+	SortByStart           = "start"
+	SortByStartDescending = "-start"
+)
+
+var ErrInvalidToken = apperrors.NewValidation("invalid_next_token", "Invalid next_token.", map[string]string{"next_token": "next_token was not issued by this listing"})
+
+var ErrSortUnsupported = apperrors.NewValidation("sort_unsupported", "Sorting is not supported here.", map[string]string{"sort": "sort is only supported when listing one creator's workshops"})
+
+// ListOptions narrows down, orders and pages a workshop listing.
+type ListOptions struct {
+	// Limit is the page size; zero means DefaultPageSize
+	Limit int
+	// NextToken continues from the page that returned it
+	NextToken string
+	// Location matches case-insensitively
+	Location string
+	// Title matches any workshop whose title contains it, case-insensitively
+	Title      string
+	HasVacancy bool
+	// When is WhenUpcoming, WhenPast or empty for both
+	When string
+	// Sort is SortByStart, SortByStartDescending or empty for storage order
+	Sort string
+	// Statuses, when set, only lists workshops in one of them
+	Statuses []string
+}
+
+// Page is one page of a listing. NextToken is empty on the last page.
+type Page struct {
+	Workshops []models.Workshop
+	NextToken string
+}
+
+func (o ListOptions) limit() int {
+	if o.Limit <= 0 {
+		return DefaultPageSize
+	}
+	if o.Limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return o.Limit
+}
+
+func (o ListOptions) matches(workshop models.Workshop, now time.Time) bool {
+	if o.Location != "" && !strings.EqualFold(strings.TrimSpace(workshop.Location), strings.TrimSpace(o.Location)) {
+		return false
+	}
+	if o.Title != "" && !strings.Contains(strings.ToLower(workshop.Title), strings.ToLower(o.Title)) {
+		return false
+	}
+	if o.HasVacancy && workshop.Vacancies <= 0 {
+		return false
+	}
+	if len(o.Statuses) > 0 && !funk.ContainsString(o.Statuses, workshop.CurrentStatus()) {
+		return false
+	}
+	if o.When != "" {
+		start, ok, err := workshop.StartTime()
+		if err != nil || !ok {
+			return false
+		}
+		if o.When == WhenUpcoming && !start.After(now) {
+			return false
+		}
+		if o.When == WhenPast && start.After(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// cursor is what an opaque next token carries. Which fields are set depends
+// on the store and on whether the listing is sorted.
+type cursor struct {
+	Creator_Id         string `json:",omitempty"`
+	Creation_Timestamp string `json:",omitempty"`
+	Start_Timestamp    string `json:",omitempty"`
+	Seq                int64  `json:",omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeCursor returns nil for an empty token, i.e. the first page.
+func decodeCursor(token string) (*cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var c cursor
+	if err := json.Unmarshal(decoded, &c); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return &c, nil
+}
+
+// startsBefore orders workshops by start time, with unscheduled workshops
+// last and ties broken by key so the order is total.
+func startsBefore(a models.Workshop, b models.Workshop) bool {
+	aStart, aOk, _ := a.StartTime()
+	bStart, bOk, _ := b.StartTime()
+	if aOk != bOk {
+		return aOk
+	}
+	if !aStart.Equal(bStart) {
+		return aStart.Before(bStart)
+	}
+	if a.Creator_Id != b.Creator_Id {
+		return a.Creator_Id < b.Creator_Id
+	}
+	return a.Creation_Timestamp < b.Creation_Timestamp
+}
+
+// pageSorted sorts every matching workshop by start time and returns the page
+// that follows the cursor. The MemoryStore sorts its listings this way, as it
+// does not keep workshops in start order.
+func pageSorted(workshops []models.Workshop, opts ListOptions, after *cursor) Page {
+	now := time.Now()
+	matching := []models.Workshop{}
+	for _, workshop := range workshops {
+		if opts.matches(workshop, now) {
+			matching = append(matching, workshop)
+		}
+	}
+	descending := opts.Sort == SortByStartDescending
+	sort.Slice(matching, func(i, j int) bool {
+		if descending {
+			return startsBefore(matching[j], matching[i])
+		}
+		return startsBefore(matching[i], matching[j])
+	})
+
+	if after != nil {
+		last := models.Workshop{
+			Creator_Id:         after.Creator_Id,
+			Creation_Timestamp: after.Creation_Timestamp,
+			Start_Timestamp:    after.Start_Timestamp,
+		}
+		skip := 0
+		for skip < len(matching) {
+			if descending && startsBefore(matching[skip], last) || !descending && startsBefore(last, matching[skip]) {
+				break
+			}
+			skip++
+		}
+		matching = matching[skip:]
+	}
+
+	page := Page{Workshops: matching}
+	if len(matching) > opts.limit() {
+		page.Workshops = matching[:opts.limit()]
+		last := page.Workshops[len(page.Workshops)-1]
+		page.NextToken = encodeCursor(cursor{
+			Creator_Id:         last.Creator_Id,
+			Creation_Timestamp: last.Creation_Timestamp,
+			Start_Timestamp:    last.Start_Timestamp,
+		})
+	}
+	return page
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"workshop/idempotency"
+)
+
+// MemoryIdempotency is an idempotency.Store held in process memory, for use
+// with the MemoryStore. Expired records are dropped as new ones are claimed.
+type MemoryIdempotency struct {
+	mu      sync.Mutex
+	records map[string]idempotency.Record
+}
+
+func NewMemoryIdempotency() *MemoryIdempotency {
+	return &MemoryIdempotency{records: map[string]idempotency.Record{}}
+}
+
+func (m *MemoryIdempotency) Claim(ctx context.Context, record idempotency.Record) (*idempotency.Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for key, existing := range m.records {
+		if !now.Before(existing.Expires_At) {
+			delete(m.records, key)
+		}
+	}
+	if existing, ok := m.records[record.Key]; ok {
+		return &existing, nil
+	}
+	m.records[record.Key] = record
+	return nil, nil
+}
+
+func (m *MemoryIdempotency) Save(ctx context.Context, record idempotency.Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[record.Key] = record
+	return nil
+}
+
+func (m *MemoryIdempotency) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
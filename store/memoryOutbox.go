@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"workshop/events"
+)
+
+// MemoryOutbox is an events.OutboxStore held in process memory, which a
+// MemoryStore records its events in. Events still in it are lost on restart.
+type MemoryOutbox struct {
+	mu       sync.Mutex
+	events   []events.Event
+	recorded chan struct{}
+}
+
+// Outbox has s record the events of every change from now on, and returns
+// the outbox to relay them from.
+func (s *MemoryStore) Outbox() *MemoryOutbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.outbox == nil {
+		s.outbox = &MemoryOutbox{recorded: make(chan struct{}, 1)}
+	}
+	return s.outbox
+}
+
+// add is called by the MemoryStore under its own lock, in the same step as
+// the change the events describe.
+func (o *MemoryOutbox) add(recorded ...events.Event) {
+	if len(recorded) == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, recorded...)
+	select {
+	case o.recorded <- struct{}{}:
+	default:
+	}
+}
+
+func (o *MemoryOutbox) Recorded() <-chan struct{} {
+	return o.recorded
+}
+
+func (o *MemoryOutbox) Pending(ctx context.Context, limit int) ([]events.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	pending := o.events
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return append([]events.Event{}, pending...), nil
+}
+
+func (o *MemoryOutbox) Remove(ctx context.Context, event events.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, recorded := range o.events {
+		if recorded.Event_Id == event.Event_Id {
+			o.events = append(o.events[:i:i], o.events[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
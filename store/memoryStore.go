@@ -0,0 +1,285 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"workshop/events"
+	"workshop/models"
+
+	"github.com/thoas/go-funk"
+)
+
+type workshopKey struct {
+	creatorID         string
+	creationTimestamp string
+}
+
+// MemoryStore is a thread-safe WorkshopStore held in process memory. It is
+// meant for local development and tests; nothing survives a restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	workshops map[workshopKey]models.Workshop
+	// order remembers insertion order so listings are stable, and seqs number
+	// each insert so a page cursor survives deletes
+	order   []workshopKey
+	seqs    map[workshopKey]int64
+	nextSeq int64
+	// registrations indexes each user's registration records by workshop
+	registrations map[string]map[workshopKey]models.Registration
+	ids           map[string]workshopKey
+	// outbox, when set, records the events of every change
+	outbox *MemoryOutbox
+}
+
+func NewMemoryStore(seed ...models.Workshop) *MemoryStore {
+	s := &MemoryStore{
+		workshops:     map[workshopKey]models.Workshop{},
+		seqs:          map[workshopKey]int64{},
+		registrations: map[string]map[workshopKey]models.Registration{},
+		ids:           map[string]workshopKey{},
+	}
+	for _, workshop := range seed {
+		s.put(workshop)
+	}
+	return s
+}
+
+func (s *MemoryStore) put(workshop models.Workshop) {
+	k := workshopKey{workshop.Creator_Id, workshop.Creation_Timestamp}
+	existing, ok := s.workshops[k]
+	if !ok {
+		s.nextSeq += 1
+		s.order = append(s.order, k)
+		s.seqs[k] = s.nextSeq
+	}
+	s.workshops[k] = copyWorkshop(workshop)
+	s.indexRegistrations(existing, workshop)
+	if existing.Workshop_Id != "" {
+		delete(s.ids, existing.Workshop_Id)
+	}
+	if workshop.Workshop_Id != "" {
+		s.ids[workshop.Workshop_Id] = k
+	}
+}
+
+// record adds the events announcing a change from before to after to the
+// outbox, if there is one and ctx does not leave the change unannounced. It
+// is called under the store lock.
+func (s *MemoryStore) record(ctx context.Context, announce announcement, before models.Workshop, after models.Workshop) {
+	if s.outbox != nil && announce != nil && !isUnannounced(ctx) {
+		s.outbox.add(announce(before, after)...)
+	}
+}
+
+// indexRegistrations brings the registration records in line with a change
+// from before to after.
+func (s *MemoryStore) indexRegistrations(before models.Workshop, after models.Workshop) {
+	k := workshopKey{after.Creator_Id, after.Creation_Timestamp}
+	puts, deletes := registrationChanges(before, after, time.Now())
+	for _, registration := range puts {
+		if s.registrations[registration.User_Id] == nil {
+			s.registrations[registration.User_Id] = map[workshopKey]models.Registration{}
+		}
+		s.registrations[registration.User_Id][k] = registration
+	}
+	for _, registration := range deletes {
+		delete(s.registrations[registration.User_Id], k)
+	}
+}
+
+func (s *MemoryStore) ListRegistrations(ctx context.Context, userID string) ([]models.Registration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	registrations := []models.Registration{}
+	for _, registration := range s.registrations[userID] {
+		registrations = append(registrations, registration)
+	}
+	sortRegistrations(registrations)
+	return registrations, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, opts ListOptions) (Page, error) {
+	return s.list(ctx, func(workshopKey) bool { return true }, opts)
+}
+
+func (s *MemoryStore) ListByCreator(ctx context.Context, creatorID string, opts ListOptions) (Page, error) {
+	return s.list(ctx, func(k workshopKey) bool { return k.creatorID == creatorID }, opts)
+}
+
+func (s *MemoryStore) list(ctx context.Context, include func(workshopKey) bool, opts ListOptions) (Page, error) {
+	if err := ctx.Err(); err != nil {
+		return Page{}, err
+	}
+	after, err := decodeCursor(opts.NextToken)
+	if err != nil {
+		return Page{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if opts.Sort != "" {
+		workshops := []models.Workshop{}
+		for _, k := range s.order {
+			if include(k) {
+				workshops = append(workshops, copyWorkshop(s.workshops[k]))
+			}
+		}
+		return pageSorted(workshops, opts, after), nil
+	}
+
+	now := time.Now()
+	page := Page{Workshops: []models.Workshop{}}
+	for _, k := range s.order {
+		if !include(k) || after != nil && s.seqs[k] <= after.Seq {
+			continue
+		}
+		workshop := s.workshops[k]
+		if !opts.matches(workshop, now) {
+			continue
+		}
+		if len(page.Workshops) == opts.limit() {
+			last := page.Workshops[len(page.Workshops)-1]
+			page.NextToken = encodeCursor(cursor{Seq: s.seqs[workshopKey{last.Creator_Id, last.Creation_Timestamp}]})
+			break
+		}
+		page.Workshops = append(page.Workshops, copyWorkshop(workshop))
+	}
+	return page, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, creatorID string, creationTimestamp string) (models.Workshop, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Workshop{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	workshop, ok := s.workshops[workshopKey{creatorID, creationTimestamp}]
+	if !ok {
+		return models.Workshop{}, ErrNotFound
+	}
+	return copyWorkshop(workshop), nil
+}
+
+func (s *MemoryStore) GetByID(ctx context.Context, workshopID string) (models.Workshop, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Workshop{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.ids[workshopID]
+	if !ok {
+		return models.Workshop{}, ErrNotFound
+	}
+	return copyWorkshop(s.workshops[k]), nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, workshop models.Workshop) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(workshop)
+	return nil
+}
+
+func (s *MemoryStore) Create(ctx context.Context, workshop models.Workshop) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.workshops[workshopKey{workshop.Creator_Id, workshop.Creation_Timestamp}]; ok {
+		return ErrAlreadyExists
+	}
+	s.put(workshop)
+	s.record(ctx, announced(events.WorkshopCreated), models.Workshop{}, workshop)
+	return nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, creatorID string, creationTimestamp string, patch models.WorkshopPatch, pre Precondition) (models.Workshop, error) {
+	var promoted []string
+	return s.mutate(ctx, creatorID, creationTimestamp, pre, applyPatch(patch, &promoted), patched(&promoted))
+}
+
+func (s *MemoryStore) Transition(ctx context.Context, creatorID string, creationTimestamp string, status string, pre Precondition) (models.Workshop, error) {
+	return s.mutate(ctx, creatorID, creationTimestamp, pre, transition(status), announced(events.WorkshopStatusChanged))
+}
+
+func (s *MemoryStore) Cancel(ctx context.Context, creatorID string, creationTimestamp string, reason string, pre Precondition) (models.Workshop, error) {
+	return s.mutate(ctx, creatorID, creationTimestamp, pre, cancel(reason), announced(events.WorkshopStatusChanged))
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, creatorID string, creationTimestamp string, pre Precondition) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := workshopKey{creatorID, creationTimestamp}
+	workshop, ok := s.workshops[k]
+	if !ok {
+		return nil
+	}
+	if pre != nil && !pre(workshop.Version) {
+		return ErrPreconditionFailed
+	}
+	s.indexRegistrations(workshop, models.Workshop{Creator_Id: creatorID, Creation_Timestamp: creationTimestamp})
+	delete(s.workshops, k)
+	delete(s.seqs, k)
+	delete(s.ids, workshop.Workshop_Id)
+	s.order = funk.Filter(s.order, func(o workshopKey) bool { return o != k }).([]workshopKey)
+	s.record(ctx, deleted, workshop, models.Workshop{})
+	return nil
+}
+
+func (s *MemoryStore) Register(ctx context.Context, creatorID string, creationTimestamp string, userID string, joinWaitlist bool, pre Precondition) (RegisterResult, error) {
+	var result RegisterResult
+	_, err := s.mutate(ctx, creatorID, creationTimestamp, pre, register(userID, joinWaitlist, &result), registered(userID, &result))
+	return result, err
+}
+
+func (s *MemoryStore) Withdraw(ctx context.Context, creatorID string, creationTimestamp string, userID string, pre Precondition) (WithdrawResult, error) {
+	var result WithdrawResult
+	_, err := s.mutate(ctx, creatorID, creationTimestamp, pre, withdraw(userID, &result), withdrew(userID, &result))
+	return result, err
+}
+
+func (s *MemoryStore) LeaveWaitlist(ctx context.Context, creatorID string, creationTimestamp string, userID string, pre Precondition) error {
+	_, err := s.mutate(ctx, creatorID, creationTimestamp, pre, leaveWaitlist(userID), leftWaitlist(userID))
+	return err
+}
+
+// mutate applies fn to a copy of the workshop under the store lock, so the
+// change, and the events announce makes of it, are only visible once it has
+// fully succeeded.
+func (s *MemoryStore) mutate(ctx context.Context, creatorID string, creationTimestamp string, pre Precondition, fn mutation, announce announcement) (models.Workshop, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Workshop{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := workshopKey{creatorID, creationTimestamp}
+	workshop, ok := s.workshops[k]
+	if !ok {
+		return models.Workshop{}, ErrNotFound
+	}
+	if pre != nil && !pre(workshop.Version) {
+		return models.Workshop{}, ErrPreconditionFailed
+	}
+	before := copyWorkshop(workshop)
+	workshop = copyWorkshop(workshop)
+	if err := fn(&workshop); err != nil {
+		return models.Workshop{}, err
+	}
+	workshop.Version += 1
+	s.workshops[k] = workshop
+	s.indexRegistrations(before, workshop)
+	s.record(ctx, announce, before, workshop)
+	return copyWorkshop(workshop), nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"workshop/models"
+
+	"github.com/google/uuid"
+)
+
+// MigrateLegacyTimestamps rewrites every workshop whose timestamps are still
+// in models.LegacyTimestampLayout as UTC RFC 3339. Migrated workshops get
+// models.LegacyTimeZone, which their times were written in, and a Workshop_Id
+// if they predate those. It returns how many workshops were migrated.
+//
+// Creation_Timestamp is part of the key, so such workshops are created anew
+// and the legacy item deleted, re-keying their registration records with
+// them. Nothing about the workshops changes for the rest of the world, so
+// none of this is announced in the outbox. Run it while the service is
+// stopped; it is safe to run again if it is interrupted.
+func MigrateLegacyTimestamps(ctx context.Context, workshops WorkshopStore) (int, error) {
+	ctx = unannounced(ctx)
+	// read everything up front so the listing does not see our own writes
+	legacy := []models.Workshop{}
+	opts := ListOptions{Limit: MaxPageSize}
+	for {
+		page, err := workshops.List(ctx, opts)
+		if err != nil {
+			return 0, err
+		}
+		for _, workshop := range page.Workshops {
+			if isLegacy(workshop) {
+				legacy = append(legacy, workshop)
+			}
+		}
+		if page.NextToken == "" {
+			break
+		}
+		opts.NextToken = page.NextToken
+	}
+
+	for i, workshop := range legacy {
+		migrated := migrateWorkshop(workshop)
+		if migrated.Creation_Timestamp == workshop.Creation_Timestamp {
+			if err := workshops.Put(ctx, migrated); err != nil {
+				return i, err
+			}
+			continue
+		}
+		// a rerun finds the migrated copy already there and only has the
+		// legacy item left to delete
+		if err := workshops.Create(ctx, migrated); errors.Is(err, ErrAlreadyExists) {
+			existing, err := workshops.Get(ctx, migrated.Creator_Id, migrated.Creation_Timestamp)
+			if err != nil {
+				return i, err
+			}
+			if existing.Workshop_Id != migrated.Workshop_Id {
+				return i, fmt.Errorf("migrating workshop %s (Creator_Id %s, Creation_Timestamp %s): %w",
+					migrated.Workshop_Id, workshop.Creator_Id, workshop.Creation_Timestamp, ErrAlreadyExists)
+			}
+		} else if err != nil {
+			return i, err
+		}
+		version := workshop.Version
+		unchanged := func(current int64) bool { return current == version }
+		if err := workshops.Delete(ctx, workshop.Creator_Id, workshop.Creation_Timestamp, unchanged); err != nil {
+			return i, err
+		}
+	}
+	return len(legacy), nil
+}
+
+// legacyWorkshopNamespace namespaces the ids given to legacy workshops.
+var legacyWorkshopNamespace = uuid.MustParse("6f1d3c2e-8a41-4f5b-9c7e-2d0b5a9e4c13")
+
+func isLegacy(workshop models.Workshop) bool {
+	return models.IsLegacyTimestamp(workshop.Creation_Timestamp) ||
+		models.IsLegacyTimestamp(workshop.Registration_Deadline) ||
+		models.IsLegacyTimestamp(workshop.Start_Timestamp)
+}
+
+// migrateWorkshop returns a copy of a legacy workshop in the current layout.
+func migrateWorkshop(workshop models.Workshop) models.Workshop {
+	migrated := copyWorkshop(workshop)
+	for _, value := range []*string{&migrated.Creation_Timestamp, &migrated.Registration_Deadline, &migrated.Start_Timestamp} {
+		if t, err := models.ParseTimestamp(*value); err == nil && models.IsLegacyTimestamp(*value) {
+			*value = models.FormatTimestamp(t)
+		}
+	}
+	if migrated.Time_Zone == "" {
+		migrated.Time_Zone = models.LegacyTimeZone
+	}
+	// the id is derived from the legacy key, so a rerun recognises the copy
+	// it made before
+	if migrated.Workshop_Id == "" {
+		migrated.Workshop_Id = uuid.NewSHA1(legacyWorkshopNamespace, []byte(workshop.Creator_Id+"#"+workshop.Creation_Timestamp)).String()
+	}
+	return migrated
+}
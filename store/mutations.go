@@ -0,0 +1,238 @@
+package store
+
+import (
+	"time"
+
+	"workshop/helpers"
+	"workshop/models"
+
+	"github.com/thoas/go-funk"
+)
+
+// mutation changes a workshop in place. Returning an error aborts the write.
+// Both stores apply mutations atomically: the memory store under its lock and
+// the DynamoDB store with a conditional write on Version.
+type mutation func(workshop *models.Workshop) error
+
+// copyWorkshop makes sure a workshop shares no slices with the original, so
+// mutating one leaves the other untouched.
+func copyWorkshop(w models.Workshop) models.Workshop {
+	if w.Attendees != nil {
+		w.Attendees = append([]string{}, w.Attendees...)
+	}
+	if w.Waitlist != nil {
+		w.Waitlist = append([]string{}, w.Waitlist...)
+	}
+	return w
+}
+
+// checkNotStarted fails once the workshop's start time has passed.
+func checkNotStarted(workshop *models.Workshop, now time.Time) error {
+	start, ok, err := workshop.StartTime()
+	if err != nil {
+		return err
+	}
+	if ok && !now.Before(start) {
+		return ErrWorkshopStarted
+	}
+	return nil
+}
+
+// checkNotEnded fails once the workshop has been cancelled or completed, as
+// its attendees are then kept as they were.
+func checkNotEnded(workshop *models.Workshop) error {
+	switch workshop.CurrentStatus() {
+	case models.StatusCancelled:
+		return ErrWorkshopCancelled
+	case models.StatusCompleted:
+		return ErrWorkshopCompleted
+	}
+	return nil
+}
+
+// checkRegistrationOpen fails unless the workshop is published, and once it
+// has started or its registration deadline has passed.
+func checkRegistrationOpen(workshop *models.Workshop, now time.Time) error {
+	switch workshop.CurrentStatus() {
+	case models.StatusDraft:
+		return ErrNotPublished
+	case models.StatusRegistrationClosed:
+		return ErrRegistrationClosed
+	}
+	if err := checkNotEnded(workshop); err != nil {
+		return err
+	}
+	if err := checkNotStarted(workshop, now); err != nil {
+		return err
+	}
+	deadline, ok, err := workshop.RegistrationDeadline()
+	if err != nil {
+		return err
+	}
+	if ok && now.After(deadline) {
+		return ErrRegistrationClosed
+	}
+	return nil
+}
+
+// register takes a vacancy for userID, or puts them at the back of the
+// waitlist when the workshop is full and joinWaitlist is set. The outcome is
+// recorded in result.
+func register(userID string, joinWaitlist bool, result *RegisterResult) mutation {
+	return func(workshop *models.Workshop) error {
+		if err := checkRegistrationOpen(workshop, time.Now()); err != nil {
+			return err
+		}
+		if funk.Contains(workshop.Attendees, userID) {
+			return ErrAlreadyRegistered
+		}
+		if funk.Contains(workshop.Waitlist, userID) {
+			return ErrAlreadyWaitlisted
+		}
+		if workshop.Vacancies <= 0 {
+			if !joinWaitlist {
+				return ErrWorkshopFull
+			}
+			workshop.Waitlist = append(workshop.Waitlist, userID)
+			*result = RegisterResult{Workshop_Id: workshop.Workshop_Id, Waitlisted: true, Position: len(workshop.Waitlist)}
+			return nil
+		}
+		workshop.Attendees = append(workshop.Attendees, userID)
+		workshop.Vacancies -= 1
+		*result = RegisterResult{Workshop_Id: workshop.Workshop_Id}
+		return nil
+	}
+}
+
+// withdraw removes userID from the attendees. The freed seat goes to the head
+// of the waitlist if anyone is waiting, otherwise it becomes a vacancy again.
+// The outcome is recorded in result.
+func withdraw(userID string, result *WithdrawResult) mutation {
+	return func(workshop *models.Workshop) error {
+		if err := checkNotEnded(workshop); err != nil {
+			return err
+		}
+		if err := checkNotStarted(workshop, time.Now()); err != nil {
+			return err
+		}
+		if !funk.Contains(workshop.Attendees, userID) {
+			return ErrNotRegistered
+		}
+		attendees, err := helpers.RemoveFromList(workshop.Attendees, funk.IndexOf(workshop.Attendees, userID))
+		if err != nil {
+			return err
+		}
+		workshop.Attendees = attendees
+		*result = WithdrawResult{Workshop_Id: workshop.Workshop_Id}
+		if len(workshop.Waitlist) > 0 {
+			result.Promoted = workshop.Waitlist[0]
+			workshop.Attendees = append(workshop.Attendees, workshop.Waitlist[0])
+			workshop.Waitlist = workshop.Waitlist[1:]
+		} else {
+			workshop.Vacancies += 1
+		}
+		return nil
+	}
+}
+
+func leaveWaitlist(userID string) mutation {
+	return func(workshop *models.Workshop) error {
+		if err := checkNotEnded(workshop); err != nil {
+			return err
+		}
+		if !funk.Contains(workshop.Waitlist, userID) {
+			return ErrNotWaitlisted
+		}
+		waitlist, err := helpers.RemoveFromListInOrder(workshop.Waitlist, funk.IndexOf(workshop.Waitlist, userID))
+		if err != nil {
+			return err
+		}
+		workshop.Waitlist = waitlist
+		return nil
+	}
+}
+
+// applyPatch changes the editable fields of a workshop. Vacancies in the patch
+// is the number of seats left, as it is everywhere else; the waitlist gets
+// them first, and the users who move off it are recorded in promoted.
+func applyPatch(patch models.WorkshopPatch, promoted *[]string) mutation {
+	return func(workshop *models.Workshop) error {
+		*promoted = nil
+		if err := checkNotEnded(workshop); err != nil {
+			return err
+		}
+		if patch.Title != nil {
+			workshop.Title = *patch.Title
+		}
+		if patch.Description != nil {
+			workshop.Description = *patch.Description
+		}
+		if patch.Location != nil {
+			workshop.Location = *patch.Location
+		}
+		// the stored times are absolute, so a new Time_Zone only changes how
+		// times sent without an offset are read
+		if patch.Time_Zone != nil {
+			workshop.Time_Zone = *patch.Time_Zone
+		}
+		if patch.Registration_Deadline != nil || patch.Start_Timestamp != nil {
+			if patch.Registration_Deadline != nil {
+				workshop.Registration_Deadline = *patch.Registration_Deadline
+			}
+			if patch.Start_Timestamp != nil {
+				workshop.Start_Timestamp = *patch.Start_Timestamp
+			}
+			if err := workshop.NormalizeSchedule(); err != nil {
+				return err
+			}
+			// re-validate the schedule as a whole when either of its times changes
+			if err := workshop.ValidateSchedule(time.Now()); err != nil {
+				return err
+			}
+		}
+		if patch.Vacancies != nil {
+			workshop.Vacancies = *patch.Vacancies
+			for workshop.Vacancies > 0 && len(workshop.Waitlist) > 0 {
+				*promoted = append(*promoted, workshop.Waitlist[0])
+				workshop.Attendees = append(workshop.Attendees, workshop.Waitlist[0])
+				workshop.Waitlist = workshop.Waitlist[1:]
+				workshop.Vacancies -= 1
+			}
+		}
+		return nil
+	}
+}
+
+// cancel cancels the workshop for reason, keeping its attendees and waitlist
+// so they can be told.
+func cancel(reason string) mutation {
+	moveTo := transition(models.StatusCancelled)
+	return func(workshop *models.Workshop) error {
+		if err := moveTo(workshop); err != nil {
+			return err
+		}
+		workshop.Cancellation_Reason = reason
+		return nil
+	}
+}
+
+// transition moves the workshop to status, if its current status allows it.
+func transition(status string) mutation {
+	return func(workshop *models.Workshop) error {
+		from := workshop.CurrentStatus()
+		if !models.CanTransition(from, status) {
+			return invalidTransition(from, status)
+		}
+		if status == models.StatusCompleted {
+			start, ok, err := workshop.StartTime()
+			if err != nil {
+				return err
+			}
+			if ok && time.Now().Before(start) {
+				return ErrWorkshopNotStarted
+			}
+		}
+		workshop.Status = status
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"workshop/models"
+)
+
+// registrationChanges works out which registration records have to be
+// written or removed to mirror a change from before to after. Users keep
+// their record as long as their status stays the same.
+func registrationChanges(before models.Workshop, after models.Workshop, now time.Time) (puts []models.Registration, deletes []models.Registration) {
+	statuses := func(workshop models.Workshop) map[string]string {
+		result := map[string]string{}
+		for _, userID := range workshop.Attendees {
+			result[userID] = models.RegistrationStatusRegistered
+		}
+		for _, userID := range workshop.Waitlist {
+			result[userID] = models.RegistrationStatusWaitlisted
+		}
+		return result
+	}
+	record := func(userID string, status string) models.Registration {
+		return models.Registration{
+			User_Id:                userID,
+			Workshop_Id:            after.Workshop_Id,
+			Creator_Id:             after.Creator_Id,
+			Creation_Timestamp:     after.Creation_Timestamp,
+			Status:                 status,
+			Registration_Timestamp: models.FormatTimestamp(now),
+		}
+	}
+
+	oldStatuses := statuses(before)
+	newStatuses := statuses(after)
+	// walk the lists rather than the maps so the changes come out in a stable order
+	for _, userID := range append(append([]string{}, after.Attendees...), after.Waitlist...) {
+		if status := newStatuses[userID]; oldStatuses[userID] != status {
+			puts = append(puts, record(userID, status))
+		}
+	}
+	for _, userID := range append(append([]string{}, before.Attendees...), before.Waitlist...) {
+		if _, ok := newStatuses[userID]; !ok {
+			deletes = append(deletes, record(userID, oldStatuses[userID]))
+		}
+	}
+	return puts, deletes
+}
+
+// sortRegistrations orders registrations by workshop key, the order DynamoDB
+// returns them in.
+func sortRegistrations(registrations []models.Registration) {
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrationKey(registrations[i]) < registrationKey(registrations[j])
+	})
+}
+
+// registrationKey identifies the workshop of a registration in a single
+// string, for use as a sort key.
+func registrationKey(registration models.Registration) string {
+	return registration.Creator_Id + "#" + registration.Creation_Timestamp
+}
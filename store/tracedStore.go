@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+
+	"workshop/apperrors"
+	"workshop/models"
+	"workshop/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedStore records a span for every operation of the store it wraps, so a
+// slow request shows which operation, and which DynamoDB call inside it, the
+// time went to. User and creator IDs are left out of the spans.
+type tracedStore struct {
+	next WorkshopStore
+}
+
+// NewTracedStore wraps next so each of its operations is traced.
+func NewTracedStore(next WorkshopStore) WorkshopStore {
+	return tracedStore{next: next}
+}
+
+func (s tracedStore) start(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "store."+operation, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends span with the outcome of the operation. Domain errors such as
+// ErrNotFound are expected answers, so only other errors mark the span as
+// failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		appErr := apperrors.From(err)
+		span.SetAttributes(attribute.String("workshop.error_code", appErr.Code))
+		if appErr.Kind == apperrors.Internal {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+func (s tracedStore) List(ctx context.Context, opts ListOptions) (Page, error) {
+	ctx, span := s.start(ctx, "List", attribute.Int("workshop.limit", opts.limit()))
+	page, err := s.next.List(ctx, opts)
+	span.SetAttributes(attribute.Int("workshop.results", len(page.Workshops)))
+	endSpan(span, err)
+	return page, err
+}
+
+func (s tracedStore) ListByCreator(ctx context.Context, creatorID string, opts ListOptions) (Page, error) {
+	ctx, span := s.start(ctx, "ListByCreator", attribute.Int("workshop.limit", opts.limit()))
+	page, err := s.next.ListByCreator(ctx, creatorID, opts)
+	span.SetAttributes(attribute.Int("workshop.results", len(page.Workshops)))
+	endSpan(span, err)
+	return page, err
+}
+
+func (s tracedStore) Get(ctx context.Context, creatorID string, creationTimestamp string) (models.Workshop, error) {
+	ctx, span := s.start(ctx, "Get")
+	workshop, err := s.next.Get(ctx, creatorID, creationTimestamp)
+	endSpan(span, err)
+	return workshop, err
+}
+
+func (s tracedStore) GetByID(ctx context.Context, workshopID string) (models.Workshop, error) {
+	ctx, span := s.start(ctx, "GetByID", attribute.String("workshop.id", workshopID))
+	workshop, err := s.next.GetByID(ctx, workshopID)
+	endSpan(span, err)
+	return workshop, err
+}
+
+func (s tracedStore) Put(ctx context.Context, workshop models.Workshop) error {
+	ctx, span := s.start(ctx, "Put", attribute.String("workshop.id", workshop.Workshop_Id))
+	err := s.next.Put(ctx, workshop)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStore) Create(ctx context.Context, workshop models.Workshop) error {
+	ctx, span := s.start(ctx, "Create", attribute.String("workshop.id", workshop.Workshop_Id))
+	err := s.next.Create(ctx, workshop)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStore) Update(ctx context.Context, creatorID string, creationTimestamp string, patch models.WorkshopPatch, pre Precondition) (models.Workshop, error) {
+	ctx, span := s.start(ctx, "Update")
+	workshop, err := s.next.Update(ctx, creatorID, creationTimestamp, patch, pre)
+	endSpan(span, err)
+	return workshop, err
+}
+
+func (s tracedStore) Transition(ctx context.Context, creatorID string, creationTimestamp string, status string, pre Precondition) (models.Workshop, error) {
+	ctx, span := s.start(ctx, "Transition")
+	workshop, err := s.next.Transition(ctx, creatorID, creationTimestamp, status, pre)
+	endSpan(span, err)
+	return workshop, err
+}
+
+func (s tracedStore) Cancel(ctx context.Context, creatorID string, creationTimestamp string, reason string, pre Precondition) (models.Workshop, error) {
+	ctx, span := s.start(ctx, "Cancel")
+	workshop, err := s.next.Cancel(ctx, creatorID, creationTimestamp, reason, pre)
+	endSpan(span, err)
+	return workshop, err
+}
+
+func (s tracedStore) Delete(ctx context.Context, creatorID string, creationTimestamp string, pre Precondition) error {
+	ctx, span := s.start(ctx, "Delete")
+	err := s.next.Delete(ctx, creatorID, creationTimestamp, pre)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStore) Register(ctx context.Context, creatorID string, creationTimestamp string, userID string, joinWaitlist bool, pre Precondition) (RegisterResult, error) {
+	ctx, span := s.start(ctx, "Register", attribute.Bool("workshop.join_waitlist", joinWaitlist))
+	result, err := s.next.Register(ctx, creatorID, creationTimestamp, userID, joinWaitlist, pre)
+	if err == nil {
+		span.SetAttributes(attribute.Bool("workshop.waitlisted", result.Waitlisted))
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedStore) Withdraw(ctx context.Context, creatorID string, creationTimestamp string, userID string, pre Precondition) (WithdrawResult, error) {
+	ctx, span := s.start(ctx, "Withdraw")
+	result, err := s.next.Withdraw(ctx, creatorID, creationTimestamp, userID, pre)
+	if err == nil {
+		span.SetAttributes(attribute.Bool("workshop.promoted", result.Promoted != ""))
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+func (s tracedStore) LeaveWaitlist(ctx context.Context, creatorID string, creationTimestamp string, userID string, pre Precondition) error {
+	ctx, span := s.start(ctx, "LeaveWaitlist")
+	err := s.next.LeaveWaitlist(ctx, creatorID, creationTimestamp, userID, pre)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStore) ListRegistrations(ctx context.Context, userID string) ([]models.Registration, error) {
+	ctx, span := s.start(ctx, "ListRegistrations")
+	registrations, err := s.next.ListRegistrations(ctx, userID)
+	span.SetAttributes(attribute.Int("workshop.results", len(registrations)))
+	endSpan(span, err)
+	return registrations, err
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"workshop/apperrors"
+	"workshop/models"
+)
+
+var (
+	ErrNotFound           = apperrors.New(apperrors.NotFound, "workshop_not_found", "Workshop not found.")
+	ErrAlreadyExists      = apperrors.New(apperrors.Conflict, "workshop_exists", "A workshop with this Creator_Id and Creation_Timestamp already exists.")
+	ErrWorkshopFull       = apperrors.New(apperrors.Full, "workshop_full", "Workshop is full.")
+	ErrAlreadyRegistered  = apperrors.New(apperrors.AlreadyRegistered, "already_registered", "User is already in attendees list!")
+	ErrAlreadyWaitlisted  = apperrors.New(apperrors.AlreadyRegistered, "already_waitlisted", "User is already on the waitlist!")
+	ErrNotRegistered      = apperrors.New(apperrors.NotRegistered, "not_registered", "UserID not found in the attendees list!")
+	ErrNotWaitlisted      = apperrors.New(apperrors.NotRegistered, "not_waitlisted", "UserID not found in the waitlist!")
+	ErrConflict           = apperrors.New(apperrors.Conflict, "concurrent_modification", "The workshop was modified concurrently, please retry.")
+	ErrRegistrationClosed = apperrors.New(apperrors.Closed, "registration_closed", "Registration for this workshop has closed.")
+	ErrWorkshopStarted    = apperrors.New(apperrors.Conflict, "workshop_started", "Workshop has already started.")
+	ErrPreconditionFailed = apperrors.New(apperrors.PreconditionFailed, "precondition_failed", "The workshop has changed since it was last fetched.")
+	ErrNotPublished       = apperrors.New(apperrors.Closed, "workshop_not_published", "Workshop has not been published yet.")
+	ErrWorkshopCancelled  = apperrors.New(apperrors.Closed, "workshop_cancelled", "Workshop has been cancelled.")
+	ErrWorkshopCompleted  = apperrors.New(apperrors.Closed, "workshop_completed", "Workshop has been completed.")
+	ErrWorkshopNotStarted = apperrors.New(apperrors.Conflict, "workshop_not_started", "Workshop cannot be completed before it starts.")
+	ErrTooManyChanges     = apperrors.New(apperrors.Unprocessable, "too_many_changes", "The change touches more registrations than can be written at once.")
+)
+
+// invalidTransition is the error for moving a workshop to a status it may not
+// move to from its current one.
+func invalidTransition(from string, to string) error {
+	return apperrors.New(apperrors.Conflict, "invalid_transition", fmt.Sprintf("A %s workshop cannot become %s.", from, to))
+}
+
+// RegisterResult describes where a user ended up after registering.
+type RegisterResult struct {
+	Workshop_Id string
+	Waitlisted  bool
+	// Position is the 1-based place on the waitlist
+	Position int
+}
+
+// WithdrawResult describes what a withdrawal changed.
+type WithdrawResult struct {
+	Workshop_Id string
+	// Promoted is the user who moved off the waitlist into the freed seat,
+	// if anyone did
+	Promoted string
+}
+
+// Precondition is checked against the current Version of a workshop before a
+// write goes ahead; when it returns false the write fails with
+// ErrPreconditionFailed. A nil Precondition always passes.
+type Precondition func(version int64) bool
+
+// WorkshopStore is the storage backend used by the workshop routes.
+// Workshops are addressed by their Creator_Id and Creation_Timestamp, and can
+// be looked up by their Workshop_Id.
+//
+// Every write takes a Precondition, which it checks in the same atomic step
+// as the write itself.
+type WorkshopStore interface {
+	// List returns one page of the workshops matching opts. It returns
+	// ErrInvalidToken if opts.NextToken was not issued by this store, and
+	// ErrSortUnsupported if the store cannot list every workshop in order.
+	List(ctx context.Context, opts ListOptions) (Page, error)
+	// ListByCreator is List narrowed down to the workshops created by creatorID.
+	ListByCreator(ctx context.Context, creatorID string, opts ListOptions) (Page, error)
+	// Get returns a single workshop, or ErrNotFound.
+	Get(ctx context.Context, creatorID string, creationTimestamp string) (models.Workshop, error)
+	// GetByID returns the workshop with the given Workshop_Id, or ErrNotFound.
+	GetByID(ctx context.Context, workshopID string) (models.Workshop, error)
+	// Put inserts the workshop, replacing any workshop with the same key.
+	Put(ctx context.Context, workshop models.Workshop) error
+	// Create inserts a new workshop, or returns ErrAlreadyExists if one with
+	// the same key is already there.
+	Create(ctx context.Context, workshop models.Workshop) error
+	// Update atomically applies the patch to an existing workshop and returns
+	// the result, or ErrNotFound. A patch that does not fit the workshop fails
+	// with a *models.FieldError.
+	Update(ctx context.Context, creatorID string, creationTimestamp string, patch models.WorkshopPatch, pre Precondition) (models.Workshop, error)
+	// Transition atomically moves a workshop to status, or fails with an
+	// invalid_transition Conflict if it may not move there from its current
+	// status. Only workshops that have started may be completed.
+	Transition(ctx context.Context, creatorID string, creationTimestamp string, status string, pre Precondition) (models.Workshop, error)
+	// Cancel atomically cancels a workshop for reason, as Transition does,
+	// keeping its attendees and waitlist.
+	Cancel(ctx context.Context, creatorID string, creationTimestamp string, reason string, pre Precondition) (models.Workshop, error)
+	// Delete removes a workshop. Deleting a missing workshop is not an error.
+	Delete(ctx context.Context, creatorID string, creationTimestamp string, pre Precondition) error
+	// Register atomically adds userID to the attendees and takes up one
+	// vacancy. If the workshop is full they join the waitlist, or when
+	// joinWaitlist is false it fails with ErrWorkshopFull. It fails with
+	// ErrWorkshopStarted or ErrRegistrationClosed once those times have
+	// passed or the workshop is not published, and with ErrConflict if the
+	// workshop kept changing underneath.
+	Register(ctx context.Context, creatorID string, creationTimestamp string, userID string, joinWaitlist bool, pre Precondition) (RegisterResult, error)
+	// Withdraw atomically removes userID from the attendees and promotes the
+	// head of the waitlist into the freed seat, or frees up one vacancy when
+	// nobody is waiting. It fails with ErrWorkshopStarted once the workshop
+	// has started, with ErrWorkshopCancelled or ErrWorkshopCompleted once it
+	// has ended, and with ErrConflict if the workshop kept changing
+	// underneath.
+	Withdraw(ctx context.Context, creatorID string, creationTimestamp string, userID string, pre Precondition) (WithdrawResult, error)
+	// LeaveWaitlist atomically removes userID from the waitlist.
+	LeaveWaitlist(ctx context.Context, creatorID string, creationTimestamp string, userID string, pre Precondition) error
+	// ListRegistrations returns the workshops userID is registered or
+	// waitlisted for. Every write above keeps these records in step with the
+	// workshops' Attendees and Waitlist.
+	ListRegistrations(ctx context.Context, userID string) ([]models.Registration, error)
+}
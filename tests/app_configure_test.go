@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http/httptest"
@@ -8,21 +9,37 @@ import (
 	"testing"
 	"time"
 
+	"workshop/config"
+	"workshop/credentials"
+	"workshop/events"
+	"workshop/health"
+	"workshop/idempotency"
 	"workshop/models"
 	"workshop/routes"
+	"workshop/store"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/gorilla/mux"
 )
 
 var testRouter *mux.Router
 var testServer *httptest.Server
 var svc *dynamodb.DynamoDB
+var testStore store.WorkshopStore
 var tableName = "workshop_test"
+var workshopIdIndexName = "Workshop_Id-index"
+var creatorStartIndexName = "Creator_Id-Start_Timestamp-index"
+var registrationsTableName = "workshop_test_registrations"
+var outboxTableName = "workshop_test_outbox"
+var idempotencyTableName = "workshop_test_idempotency"
+
+// testOutboxStore and testIdempotencyStore are kept next to testStore, in
+// memory or in DynamoDB. testStore records the events of its changes in
+// testOutboxStore.
+var testOutboxStore events.OutboxStore
+var testIdempotencyStore idempotency.Store
 var testDBSeedData = []models.Workshop{
 	{
 		Creator_Id:            "2",
@@ -32,8 +49,8 @@ var testDBSeedData = []models.Workshop{
 		Location:              "123 Circle Road",
 		Vacancies:             11,
 		Attendees:             []string{"64"},
-		Registration_Deadline: "2024-02-17-23:59:59.000",
-		Start_Timestamp:       "2024-02-10-15:00:00.000",
+		Registration_Deadline: "2099-02-09-23:59:59.000",
+		Start_Timestamp:       "2099-02-10-15:00:00.000",
 	},
 	{
 		Creator_Id:            "1",
@@ -43,8 +60,8 @@ var testDBSeedData = []models.Workshop{
 		Location:              "123 Example Road",
 		Vacancies:             7,
 		Attendees:             []string{"999"},
-		Registration_Deadline: "2024-02-08-23:59:59.000",
-		Start_Timestamp:       "2024-02-15-15:00:00.000",
+		Registration_Deadline: "2099-02-08-23:59:59.000",
+		Start_Timestamp:       "2099-02-15-15:00:00.000",
 	},
 }
 
@@ -63,7 +80,7 @@ func doesTableExist(name string, svc *dynamodb.DynamoDB) bool {
 func hasTableBeenFullyDeleted(name string, svc *dynamodb.DynamoDB) bool {
 	maxRetries := 5
 	for i := 0; i <= maxRetries; i++ {
-		var tableExists bool = doesTableExist(tableName, svc)
+		var tableExists bool = doesTableExist(name, svc)
 		if tableExists && i == maxRetries {
 			log.Fatalf("Max retries exceeded! Test table has not been fully deleted, and we cannot proceed.\n")
 		} else if tableExists {
@@ -78,7 +95,7 @@ func hasTableBeenFullyDeleted(name string, svc *dynamodb.DynamoDB) bool {
 func hasTableBeenFullyCreated(name string, svc *dynamodb.DynamoDB) bool {
 	maxRetries := 5
 	for i := 0; i <= maxRetries; i++ {
-		var tableExists bool = doesTableExist(tableName, svc)
+		var tableExists bool = doesTableExist(name, svc)
 		if !tableExists && i == maxRetries {
 			log.Fatalf("Max retries exceeded! Test table has not been fully created, and we cannot proceed.\n")
 		} else if !tableExists {
@@ -104,20 +121,63 @@ func hasTableBeenFullyCreated(name string, svc *dynamodb.DynamoDB) bool {
 	return false
 }
 
-// TestMain allows us to do setup and teardown operations before running tests
+// TestMain allows us to do setup and teardown operations before running tests.
+// The tests run against the in-memory store unless WORKSHOP_TEST_STORE=dynamodb,
+// in which case a live workshop_test table is recreated and seeded.
 func TestMain(m *testing.M) {
+	if os.Getenv("WORKSHOP_TEST_STORE") == "dynamodb" {
+		testStore = setUpDynamoStore()
+	} else {
+		memoryStore := store.NewMemoryStore(testDBSeedData...)
+		testStore = memoryStore
+		testOutboxStore = memoryStore.Outbox()
+		testIdempotencyStore = store.NewMemoryIdempotency()
+	}
+
+	/*-------------------------------------------------------
+	Initializing a new router and server to use for the tests
+	-------------------------------------------------------*/
+	testRouter = mux.NewRouter()
+	routes.RegisterRoutes(testRouter, testStore, routes.Options{})
+	var checks []health.Check
+	if dynamoStore, ok := testStore.(*store.DynamoStore); ok {
+		checks = dynamoStore.HealthChecks()
+	}
+	routes.RegisterHealthRoutes(testRouter, health.NewChecker(time.Second, checks...))
+	routes.RegisterMetricsRoutes(testRouter)
+
+	testServer = httptest.NewServer(routes.Middleware(testRouter))
+	defer testServer.Close()
+
+	exitCode := m.Run()
+
+	os.Exit(exitCode)
+}
+
+func setUpDynamoStore() store.WorkshopStore {
 	/*--------------------------------------------
 	SETTING UP THE DB
 	--------------------------------------------*/
 
-	AKID := ""
-	SECRET_KEY := ""
+	// the region, endpoint, credentials and timeouts come from the same configuration as
+	// the service, so WORKSHOP_DYNAMODB_ENDPOINT points the tests at DynamoDB
+	// Local; only the tables are the test harness' own
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%s", err)
+	}
+
+	awsConfig := cfg.AWSConfig()
+	creds, err := credentials.New(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Error getting AWS credentials: %v", err)
+	}
+	if creds != nil {
+		awsConfig = awsConfig.WithCredentials(creds)
+	}
 
 	// Initialize a session
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String("ap-southeast-1"),
-		Credentials: credentials.NewStaticCredentials(AKID, SECRET_KEY, ""),
-	})
+	sess, err := session.NewSession(awsConfig)
 	if err != nil {
 		log.Println("Error getting session:")
 		log.Fatal(err)
@@ -125,96 +185,138 @@ func TestMain(m *testing.M) {
 	fmt.Println("After creating test session")
 
 	//create dynamoDB client
-	svc = dynamodb.New(sess, aws.NewConfig().WithLogLevel(aws.LogDebugWithHTTPBody))
+	svc = dynamodb.New(sess)
+
+	recreateTable(tableName, "Creator_Id", "Creation_Timestamp",
+		testIndex{name: workshopIdIndexName, partitionKey: "Workshop_Id"},
+		testIndex{name: creatorStartIndexName, partitionKey: "Creator_Id", sortKey: "Start_Timestamp"})
+	recreateTable(registrationsTableName, "User_Id", "Workshop_Key")
+	recreateTable(outboxTableName, "Outbox", "Sequence")
+	recreateTable(idempotencyTableName, "Idempotency_Key", "")
 
+	//seed the created testTable with data, indexing the seeded registrations as well
+	dynamoStore := store.NewDynamoStore(svc, store.DynamoTables{
+		Workshops:         tableName,
+		WorkshopIdIndex:   workshopIdIndexName,
+		CreatorStartIndex: creatorStartIndexName,
+		Registrations:     registrationsTableName,
+	})
+	for _, record := range testDBSeedData {
+		if err := dynamoStore.Put(context.Background(), record); err != nil {
+			log.Fatalf("Failed to add record: %v", err)
+		}
+	}
+	fmt.Printf("Records added to table %s.\n", tableName)
+	testOutboxStore = dynamoStore.Outbox(outboxTableName)
+	testIdempotencyStore = dynamoStore.Idempotency(idempotencyTableName)
+
+	return dynamoStore
+}
+
+// testIndex describes a global secondary index of a test table. An index
+// with a sort key projects every attribute, as listings read whole workshops
+// from it; one without only projects the keys.
+type testIndex struct {
+	name         string
+	partitionKey string
+	sortKey      string
+}
+
+// recreateTable drops the named test table if it exists and creates it afresh
+// with the given string partition key, sort key if there is one, and indexes.
+func recreateTable(name string, partitionKey string, sortKey string, indexes ...testIndex) {
 	//check for existence of testTable and initiate deletion it if it exists
-	var tableExists bool = doesTableExist(tableName, svc)
+	var tableExists bool = doesTableExist(name, svc)
 
 	if tableExists {
 		deleteTableInput := &dynamodb.DeleteTableInput{
-			TableName: aws.String(tableName),
+			TableName: aws.String(name),
 		}
 
-		_, err = svc.DeleteTable(deleteTableInput)
+		_, err := svc.DeleteTable(deleteTableInput)
 		if err != nil {
 			log.Fatalf("Failed to delete test table: %v", err)
-			return
 		}
-		fmt.Printf("Test table %s deleted.\n", tableName)
+		fmt.Printf("Test table %s deleted.\n", name)
 	}
 
 	//If the testTable has been fully deleted, create a new testTable
-	if hasTableBeenFullyDeleted(tableName, svc) == true {
+	if hasTableBeenFullyDeleted(name, svc) == true {
 		createTableInput := &dynamodb.CreateTableInput{
-			TableName: aws.String(tableName),
+			TableName: aws.String(name),
 			KeySchema: []*dynamodb.KeySchemaElement{
 				{
-					AttributeName: aws.String("Creator_Id"), // Partition Key
+					AttributeName: aws.String(partitionKey), // Partition Key
 					KeyType:       aws.String("HASH"),
 				},
-				{
-					AttributeName: aws.String("Creation_Timestamp"), // Sort Key
-					KeyType:       aws.String("RANGE"),
-				},
 			},
 			AttributeDefinitions: []*dynamodb.AttributeDefinition{
 				{
-					AttributeName: aws.String("Creator_Id"),
+					AttributeName: aws.String(partitionKey),
 					AttributeType: aws.String("S"), // S represents String
 				},
-				{
-					AttributeName: aws.String("Creation_Timestamp"),
-					AttributeType: aws.String("S"),
-				},
 			},
 			ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
 				ReadCapacityUnits:  aws.Int64(5), // Adjust as needed
 				WriteCapacityUnits: aws.Int64(5), // Adjust as needed
 			},
 		}
-
-		_, err = svc.CreateTable(createTableInput)
-		if err != nil {
-			log.Fatalf("Failed to create test table: %v", err)
-			return
+		if sortKey != "" {
+			createTableInput.KeySchema = append(createTableInput.KeySchema, &dynamodb.KeySchemaElement{
+				AttributeName: aws.String(sortKey), // Sort Key
+				KeyType:       aws.String("RANGE"),
+			})
+			createTableInput.AttributeDefinitions = append(createTableInput.AttributeDefinitions, &dynamodb.AttributeDefinition{
+				AttributeName: aws.String(sortKey),
+				AttributeType: aws.String("S"),
+			})
 		}
-		fmt.Printf("Test table %s created.\n", tableName)
-	}
-
-	//if the testTable has been fully created, seed the created testTable with data
-	if hasTableBeenFullyCreated(tableName, svc) == true {
-		var records = testDBSeedData
-
-		for _, record := range records {
-			av, err := dynamodbattribute.MarshalMap(record)
-			if err != nil {
-				log.Fatalf("Failed to marshal record: %v", err)
-				return
+		defined := map[string]bool{partitionKey: true, sortKey: true}
+		for _, index := range indexes {
+			keySchema := []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String(index.partitionKey),
+					KeyType:       aws.String("HASH"),
+				},
 			}
-
-			putItemInput := &dynamodb.PutItemInput{
-				Item:      av,
-				TableName: aws.String(tableName),
+			projection := "KEYS_ONLY"
+			if index.sortKey != "" {
+				keySchema = append(keySchema, &dynamodb.KeySchemaElement{
+					AttributeName: aws.String(index.sortKey),
+					KeyType:       aws.String("RANGE"),
+				})
+				projection = "ALL"
 			}
-
-			_, err = svc.PutItem(putItemInput)
-			if err != nil {
-				log.Fatalf("Failed to add record: %v", err)
+			for _, key := range []string{index.partitionKey, index.sortKey} {
+				if key != "" && !defined[key] {
+					defined[key] = true
+					createTableInput.AttributeDefinitions = append(createTableInput.AttributeDefinitions, &dynamodb.AttributeDefinition{
+						AttributeName: aws.String(key),
+						AttributeType: aws.String("S"),
+					})
+				}
 			}
+			createTableInput.GlobalSecondaryIndexes = append(createTableInput.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndex{
+				IndexName: aws.String(index.name),
+				KeySchema: keySchema,
+				Projection: &dynamodb.Projection{
+					ProjectionType: aws.String(projection),
+				},
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(5),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+			})
 		}
-		fmt.Printf("Records added to table %s.\n", tableName)
-	}
 
-	/*-------------------------------------------------------
-	Initializing a new router and server to use for the tests
-	-------------------------------------------------------*/
-	testRouter = mux.NewRouter()
-	routes.RegisterRoutes(testRouter, svc, tableName)
-
-	testServer = httptest.NewServer(testRouter)
-	defer testServer.Close()
-
-	exitCode := m.Run()
+		_, err := svc.CreateTable(createTableInput)
+		if err != nil {
+			log.Fatalf("Failed to create test table: %v", err)
+		}
+		fmt.Printf("Test table %s created.\n", name)
+	}
 
-	os.Exit(exitCode)
+	if !hasTableBeenFullyCreated(name, svc) {
+		log.Fatalf("Test table %s is not active, and we cannot proceed.\n", name)
+	}
 }
@@ -1,12 +1,17 @@
 package tests
 
-import(
+import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"testing"
-	"log"
-	"bytes"
-	"io/ioutil"
+
+	"workshop/models"
+	"workshop/store"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -44,8 +49,8 @@ func TestCreate(t *testing.T) {
 		"Description": "This is for testing", 
 		"Location": "123 Test Road",
 		"Vacancies": 22,
-		"Registration_Deadline": "2024-02-17-23:59:59.000",
-		"Start_Timestamp": "2024-02-10-15:00:00.000",
+		"Registration_Deadline": "2099-02-09-23:59:59.000",
+		"Start_Timestamp": "2099-02-10-15:00:00.000",
 	}
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
@@ -59,23 +64,139 @@ func TestCreate(t *testing.T) {
     assert.Equal(t, 201, res.StatusCode, "Expected result to be %d, but got %d", 201, res.StatusCode)
 }
 
-// func TestGetByCreatorID(t *testing.T) {
+func TestGetByCreatorID(t *testing.T) {
+	res, err := http.Get(testServer.URL + "/workshop/1")
+	if err != nil {
+		log.Fatalf("Failed to send the HTTP request: %v", err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		log.Fatalf("Failed to read the response body in TestGetByCreatorID: %v", err)
+	}
+	expectedJson, err := json.Marshal([]models.Workshop{testDBSeedData[1]})
+	if err != nil {
+		log.Fatalf("Failed to marshal testDBSeedData to JSON in TestGetByCreatorID: %v", err)
+	}
 
-// }
+	assert.Equal(t, 200, res.StatusCode, "Expected result to be %d, but got %d", 200, res.StatusCode)
+	assert.Equal(t, string(expectedJson), string(body))
+}
+
+func TestPatch(t *testing.T) {
+	workshop := models.Workshop{
+		Creator_Id:            "patch",
+		Creation_Timestamp:    "2023-11-11-10:00:00.000",
+		Title:                 "Patch me",
+		Vacancies:             0,
+		Attendees:             []string{"p1", "p2"},
+		Waitlist:              []string{"p3", "p4"},
+		Registration_Deadline: "2099-02-08-23:59:59.000",
+		Start_Timestamp:       "2099-02-15-15:00:00.000",
+	}
+	if err := testStore.Put(context.Background(), workshop); err != nil {
+		log.Fatalf("Failed to seed the workshop in TestPatch: %v", err)
+	}
+	url := testServer.URL + "/workshop/patch/2023-11-11-10:00:00.000"
 
+	res, _ := sendPatch(url, map[string]interface{}{"Title": "Patched", "Location": "456 Other Road"})
+	assert.Equal(t, 200, res.StatusCode, "Expected result to be %d, but got %d", 200, res.StatusCode)
 
-// func TestPatch(t *testing.T) {
-	
-// }
+	// fields outside the whitelist, wrong types and out of range values are all reported
+	res, body := sendPatch(url, map[string]interface{}{"Creator_Id": "someone-else", "Vacancies": "lots", "Title": "", "Odd Field!": 1})
+	assert.Equal(t, 400, res.StatusCode, "Expected result to be %d, but got %d", 400, res.StatusCode)
+	assert.Len(t, body["fields"], 4)
+
+	// one seat left lets the head of the waitlist in
+	res, _ = sendPatch(url, map[string]interface{}{"Vacancies": 1})
+	assert.Equal(t, 200, res.StatusCode, "Expected result to be %d, but got %d", 200, res.StatusCode)
+
+	result, err := testStore.Get(context.Background(), "patch", "2023-11-11-10:00:00.000")
+	if err != nil {
+		log.Fatalf("Failed to read back the workshop in TestPatch: %v", err)
+	}
+	assert.Equal(t, "Patched", result.Title)
+	assert.Equal(t, "456 Other Road", result.Location)
+	assert.Equal(t, []string{"p1", "p2", "p3"}, result.Attendees)
+	assert.Equal(t, []string{"p4"}, result.Waitlist)
+	assert.Equal(t, int64(0), result.Vacancies)
+
+	// Vacancies means seats left both ways, so what is sent is what is read
+	// back once the waitlist has moved up
+	res, _ = sendPatch(url, map[string]interface{}{"Vacancies": 3})
+	assert.Equal(t, 200, res.StatusCode, "Expected result to be %d, but got %d", 200, res.StatusCode)
+	res, body = sendRequest(http.MethodGet, url, nil, nil)
+	assert.Equal(t, 200, res.StatusCode, "Expected result to be %d, but got %d", 200, res.StatusCode)
+	assert.Equal(t, float64(2), body["Vacancies"])
+	assert.Equal(t, []interface{}{"p1", "p2", "p3", "p4"}, body["Attendees"])
+
+	res, _ = sendPatch(testServer.URL+"/workshop/patch/2000-01-01-00:00:00.000", map[string]interface{}{"Title": "Ghost"})
+	assert.Equal(t, 404, res.StatusCode, "Expected result to be %d, but got %d", 404, res.StatusCode)
+	_, err = testStore.Get(context.Background(), "patch", "2000-01-01-00:00:00.000")
+	assert.Equal(t, store.ErrNotFound, err)
+}
 
 // func TestDelete(t *testing.T) {
 
 // }
 
-// func TestRegister(t *testing.T) {
+func TestRegister(t *testing.T) {
+	url := testServer.URL + "/workshop/register/2/2023-10-20-21:22:22.080"
 
-// }
+	res, _ := sendPatch(url, map[string]interface{}{"User_Id": "65"})
+	assert.Equal(t, 200, res.StatusCode, "Expected result to be %d, but got %d", 200, res.StatusCode)
+
+	res, _ = sendPatch(url, map[string]interface{}{"User_Id": "65"})
+	assert.Equal(t, 400, res.StatusCode, "Expected result to be %d, but got %d", 400, res.StatusCode)
+}
 
-// func TestWithdraw(t *testing.T) {
+func TestWithdraw(t *testing.T) {
+	url := testServer.URL + "/workshop/withdraw/2/2023-10-20-21:22:22.080"
+
+	res, _ := sendPatch(url, map[string]interface{}{"User_Id": "65"})
+	assert.Equal(t, 200, res.StatusCode, "Expected result to be %d, but got %d", 200, res.StatusCode)
+
+	res, _ = sendPatch(url, map[string]interface{}{"User_Id": "65"})
+	assert.Equal(t, 400, res.StatusCode, "Expected result to be %d, but got %d", 400, res.StatusCode)
+}
+
+// sendPatch sends a JSON PATCH request and decodes the JSON response body
+func sendPatch(url string, requestBody map[string]interface{}) (*http.Response, map[string]interface{}) {
+	return sendRequest(http.MethodPatch, url, requestBody, nil)
+}
 
-// }
\ No newline at end of file
+// sendRequest sends a request with an optional JSON body and extra headers,
+// and decodes the JSON response body if there is one
+func sendRequest(method string, url string, requestBody map[string]interface{}, header http.Header) (*http.Response, map[string]interface{}) {
+	var body io.Reader
+	if requestBody != nil {
+		jsonData, err := json.Marshal(requestBody)
+		if err != nil {
+			log.Fatalf("Failed to marshal requestBody JSON: %v", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		log.Fatalf("Failed to build the %s request: %v", method, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("Failed to send the HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+	responseBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.Fatalf("Failed to read the response body: %v", err)
+	}
+	var responseBody map[string]interface{}
+	if len(responseBytes) > 0 {
+		if err := json.Unmarshal(responseBytes, &responseBody); err != nil {
+			log.Fatalf("Failed to decode the response body: %v", err)
+		}
+	}
+	return res, responseBody
+}
@@ -0,0 +1,254 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"workshop/auth"
+	"workshop/config"
+	"workshop/models"
+	"workshop/routes"
+	"workshop/store"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const testJWTSecret = "a-test-secret-that-is-long-enough"
+
+// hs256Auth is the configuration most of these tests authenticate with.
+var hs256Auth = config.Auth{Mode: config.AuthJWT, Algorithm: config.JWTHS256, Secret: testJWTSecret, AdminRole: "admin"}
+
+// token returns an HS256 token for subject, valid for an hour, with the given
+// roles.
+func token(t *testing.T, subject string, roles ...string) string {
+	return signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "", jwt.MapClaims{
+		"sub":   subject,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": roles,
+	})
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	unsigned := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		unsigned.Header["kid"] = kid
+	}
+	signed, err := unsigned.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign a token: %v", err)
+	}
+	return signed
+}
+
+func problemCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		return ""
+	}
+	code, _ := body["code"].(string)
+	return code
+}
+
+func seedAuthWorkshop(t *testing.T, creatorID string) string {
+	workshop := models.Workshop{
+		Workshop_Id:           "auth-" + creatorID,
+		Creator_Id:            creatorID,
+		Creation_Timestamp:    "2023-11-26T10:00:00.000Z",
+		Vacancies:             5,
+		Attendees:             []string{},
+		Registration_Deadline: "2099-02-08T23:59:59.000Z",
+		Start_Timestamp:       "2099-02-15T15:00:00.000Z",
+	}
+	if err := testStore.Put(context.Background(), workshop); err != nil {
+		t.Fatalf("Failed to seed the workshop: %v", err)
+	}
+	return "/workshop/id/" + workshop.Workshop_Id
+}
+
+func TestRequestsNeedAValidToken(t *testing.T) {
+	captureLog(t)
+	handler := newHandler(testStore, routes.Options{Authenticator: newAuthenticator(t, hs256Auth)})
+	url := seedAuthWorkshop(t, "auth-creator") + "/register"
+
+	// reading needs no token
+	assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/workshop", "").Code)
+
+	rec := serveRequest(handler, http.MethodPatch, url, "")
+	assert.Equal(t, 401, rec.Code)
+	assert.Equal(t, "unauthenticated", problemCode(t, rec))
+	assert.Equal(t, `Bearer realm="workshop"`, rec.Header().Get("WWW-Authenticate"))
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for name, bad := range map[string]string{
+		"garbage":         "not-a-token",
+		"expired":         signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"no expiry":       signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "", jwt.MapClaims{"sub": "alice"}),
+		"no subject":      signToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), "", jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}),
+		"wrong secret":    signToken(t, jwt.SigningMethodHS256, []byte("another-secret-that-is-long-enough"), "", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}),
+		"wrong algorithm": signToken(t, jwt.SigningMethodRS256, otherKey, "", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}),
+		"unsigned":        signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}),
+	} {
+		rec := serveRequest(handler, http.MethodPatch, url, "", withToken(bad))
+		assert.Equal(t, 401, rec.Code, name)
+		assert.Equal(t, "invalid_token", problemCode(t, rec), name)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`, name)
+	}
+
+	// a token that does not check out is turned away even where none is needed
+	assert.Equal(t, 401, serveRequest(handler, http.MethodGet, "/workshop", "", withToken("not-a-token")).Code)
+}
+
+func TestCallersActForThemselves(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{Authenticator: newAuthenticator(t, hs256Auth)})
+	url := seedAuthWorkshop(t, "auth-host")
+
+	// the caller registers themselves, without naming anyone
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url+"/register", "", withToken(token(t, "alice"))).Code)
+	rec := serveRequest(handler, http.MethodPatch, url+"/register", `{"User_Id": "bob"}`, withToken(token(t, "alice")))
+	assert.Equal(t, 403, rec.Code)
+	assert.Equal(t, "forbidden", problemCode(t, rec))
+	// admins may act for anyone
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url+"/register", `{"User_Id": "bob"}`, withToken(token(t, "support", "admin"))).Code)
+
+	workshop, err := testStore.GetByID(context.Background(), "auth-auth-host")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, workshop.Attendees)
+
+	assert.Equal(t, 403, serveRequest(handler, http.MethodPatch, url+"/withdraw", `{"User_Id": "bob"}`, withToken(token(t, "alice"))).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url+"/withdraw", `{"User_Id": "alice"}`, withToken(token(t, "alice"))).Code)
+
+	// registrations are private
+	assert.Equal(t, 401, serveRequest(handler, http.MethodGet, "/users/bob/registrations", "").Code)
+	assert.Equal(t, 403, serveRequest(handler, http.MethodGet, "/users/bob/registrations", "", withToken(token(t, "alice"))).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/users/bob/registrations", "", withToken(token(t, "bob"))).Code)
+	// a waitlist position is for the user and the workshop's creator
+	assert.Equal(t, 403, serveRequest(handler, http.MethodGet, url+"/waitlist/bob", "", withToken(token(t, "alice"))).Code)
+	assert.Equal(t, 404, serveRequest(handler, http.MethodGet, url+"/waitlist/bob", "", withToken(token(t, "auth-host"))).Code)
+}
+
+func TestOnlyCreatorsManageTheirWorkshops(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{Authenticator: newAuthenticator(t, hs256Auth)})
+	schedule := `"Registration_Deadline": "2099-02-08T23:59:59Z", "Start_Timestamp": "2099-02-15T15:00:00Z"`
+
+	// workshops belong to whoever creates them
+	rec := serveRequest(handler, http.MethodPost, "/workshop", `{`+schedule+`}`, withToken(token(t, "carol")))
+	assert.Equal(t, 201, rec.Code)
+	url := rec.Header().Get("Location")
+	created, err := testStore.GetByID(context.Background(), strings.TrimPrefix(url, "/workshop/id/"))
+	assert.NoError(t, err)
+	assert.Equal(t, "carol", created.Creator_Id)
+	assert.Equal(t, 403, serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "dave", `+schedule+`}`, withToken(token(t, "carol"))).Code)
+	assert.Equal(t, 401, serveRequest(handler, http.MethodPost, "/workshop", `{`+schedule+`}`).Code)
+
+	assert.Equal(t, 401, serveRequest(handler, http.MethodPatch, url, `{"Title": "Anyone's"}`).Code)
+	assert.Equal(t, 403, serveRequest(handler, http.MethodPatch, url, `{"Title": "Dave's"}`, withToken(token(t, "dave"))).Code)
+	assert.Equal(t, 403, serveRequest(handler, http.MethodPatch, "/workshop/carol/"+created.Creation_Timestamp, `{"Title": "Dave's"}`, withToken(token(t, "dave"))).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url, `{"Title": "Carol's"}`, withToken(token(t, "carol"))).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url, `{"Title": "Moderated"}`, withToken(token(t, "support", "admin"))).Code)
+
+	assert.Equal(t, 403, serveRequest(handler, http.MethodDelete, url, "", withToken(token(t, "dave"))).Code)
+	// creators cancel their workshops; only admins delete them
+	rec = serveRequest(handler, http.MethodDelete, url, "", withToken(token(t, "carol")))
+	assert.Equal(t, 403, rec.Code)
+	assert.Equal(t, "admin_only", problemCode(t, rec))
+	assert.Equal(t, 403, serveRequest(handler, http.MethodDelete, "/workshop/carol/"+created.Creation_Timestamp, "", withToken(token(t, "dave"))).Code)
+	// a workshop that does not exist looks the same to them
+	rec = serveRequest(handler, http.MethodDelete, "/workshop/id/no-such-workshop", "", withToken(token(t, "dave")))
+	assert.Equal(t, 403, rec.Code)
+	assert.Equal(t, "admin_only", problemCode(t, rec))
+	assert.Equal(t, 200, serveRequest(handler, http.MethodDelete, url, "", withToken(token(t, "support", "admin"))).Code)
+	assert.Equal(t, 404, serveRequest(handler, http.MethodDelete, url, "", withToken(token(t, "support", "admin"))).Code)
+	_, err = testStore.GetByID(context.Background(), created.Workshop_Id)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestRS256Keys(t *testing.T) {
+	captureLog(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pemFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+	jwksFile := filepath.Join(dir, "jwks.json")
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "EC", "kid": "ignored"},
+		{
+			"kty": "RSA",
+			"kid": "2024-01",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		},
+	}})
+	os.WriteFile(jwksFile, jwks, 0o600)
+
+	claims := func(issuer string) jwt.MapClaims {
+		return jwt.MapClaims{"sub": "erin", "exp": time.Now().Add(time.Hour).Unix(), "iss": issuer, "aud": "workshop"}
+	}
+	for name, cfg := range map[string]config.Auth{
+		"pem":  {Mode: config.AuthJWT, Algorithm: config.JWTRS256, PublicKeyFile: pemFile, Issuer: "https://id.example", Audience: "workshop", AdminRole: "admin"},
+		"jwks": {Mode: config.AuthJWT, Algorithm: config.JWTRS256, JWKSFile: jwksFile, Issuer: "https://id.example", Audience: "workshop", AdminRole: "admin"},
+	} {
+		handler := newHandler(testStore, routes.Options{Authenticator: newAuthenticator(t, cfg)})
+		good := signToken(t, jwt.SigningMethodRS256, key, "2024-01", claims("https://id.example"))
+		assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/users/erin/registrations", "", withToken(good)).Code, name)
+		wrongIssuer := signToken(t, jwt.SigningMethodRS256, key, "2024-01", claims("https://elsewhere.example"))
+		assert.Equal(t, 401, serveRequest(handler, http.MethodGet, "/users/erin/registrations", "", withToken(wrongIssuer)).Code, name)
+	}
+
+	handler := newHandler(testStore, routes.Options{Authenticator: newAuthenticator(t, config.Auth{Mode: config.AuthJWT, Algorithm: config.JWTRS256, JWKSFile: jwksFile, AdminRole: "admin"})})
+	unknownKid := signToken(t, jwt.SigningMethodRS256, key, "2023-12", claims(""))
+	assert.Equal(t, 401, serveRequest(handler, http.MethodGet, "/users/erin/registrations", "", withToken(unknownKid)).Code)
+
+	_, err = auth.New(config.Auth{Mode: config.AuthJWT, Algorithm: config.JWTRS256, JWKSFile: filepath.Join(dir, "missing.json")})
+	assert.Error(t, err)
+}
+
+func TestAuthConfiguration(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupIn(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, config.AuthNone, cfg.Auth.Mode)
+
+	cfg, err = config.LoadFrom(lookupIn(map[string]string{
+		"WORKSHOP_AUTH":          "JWT",
+		"WORKSHOP_JWT_ALGORITHM": "hs256",
+		"WORKSHOP_JWT_SECRET":    testJWTSecret,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, config.JWTHS256, cfg.Auth.Algorithm)
+	assert.Equal(t, "admin", cfg.Auth.AdminRole)
+
+	_, err = config.LoadFrom(lookupIn(map[string]string{
+		"WORKSHOP_AUTH":          "jwt",
+		"WORKSHOP_JWT_ALGORITHM": "HS256",
+		"WORKSHOP_JWT_SECRET":    "short",
+	}))
+	assert.ErrorContains(t, err, "WORKSHOP_JWT_SECRET")
+	_, err = config.LoadFrom(lookupIn(map[string]string{
+		"WORKSHOP_AUTH":                "jwt",
+		"WORKSHOP_JWT_PUBLIC_KEY_FILE": "key.pem",
+		"WORKSHOP_JWT_JWKS_FILE":       "jwks.json",
+	}))
+	assert.ErrorContains(t, err, "exactly one of")
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_AUTH": "jwt", "WORKSHOP_JWT_ALGORITHM": "ES256"}))
+	assert.ErrorContains(t, err, "WORKSHOP_JWT_ALGORITHM")
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_AUTH": "oauth"}))
+	assert.ErrorContains(t, err, "WORKSHOP_AUTH")
+}
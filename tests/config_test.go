@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"workshop/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupIn(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, config.Default(), cfg)
+	assert.Equal(t, ":8080", cfg.Addr())
+}
+
+func TestConfigFileAndEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workshop.json")
+	err := os.WriteFile(path, []byte(`{
+		"WORKSHOP_PORT": 9090,
+		"WORKSHOP_REGION": "eu-west-1",
+		"WORKSHOP_TABLE": "from_file",
+		"WORKSHOP_DYNAMODB_ENDPOINT": "http://localhost:8000",
+		"WORKSHOP_READ_TIMEOUT": "2s"
+	}`), 0o600)
+	assert.NoError(t, err)
+
+	cfg, err := config.LoadFrom(lookupIn(map[string]string{
+		config.FileEnv:       path,
+		"WORKSHOP_TABLE":     "from_env",
+		"WORKSHOP_LOG_LEVEL": "DEBUG",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 9090, cfg.Port)
+	assert.Equal(t, "eu-west-1", cfg.Region)
+	// the environment wins over the file
+	assert.Equal(t, "from_env", cfg.Tables.Workshops)
+	assert.Equal(t, "http://localhost:8000", cfg.DynamoDBEndpoint)
+	assert.Equal(t, 2*time.Second, cfg.Timeouts.Read)
+	assert.Equal(t, config.LogLevelDebug, cfg.LogLevel)
+	assert.Equal(t, "http://localhost:8000", *cfg.AWSConfig().Endpoint)
+}
+
+func TestConfigRejectsInvalidSettings(t *testing.T) {
+	_, err := config.LoadFrom(lookupIn(map[string]string{
+		"WORKSHOP_PORT":              "70000",
+		"WORKSHOP_STORE":             "postgres",
+		"WORKSHOP_LOG_LEVEL":         "chatty",
+		"WORKSHOP_WRITE_TIMEOUT":     "0s",
+		"WORKSHOP_DYNAMODB_ENDPOINT": "localhost",
+	}))
+	if assert.Error(t, err) {
+		// every problem is reported at once
+		assert.Contains(t, err.Error(), "WORKSHOP_PORT")
+		assert.Contains(t, err.Error(), "WORKSHOP_STORE")
+		assert.Contains(t, err.Error(), "WORKSHOP_LOG_LEVEL")
+		assert.Contains(t, err.Error(), "WORKSHOP_WRITE_TIMEOUT")
+	}
+
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_IDLE_TIMEOUT": "soon"}))
+	assert.ErrorContains(t, err, "WORKSHOP_IDLE_TIMEOUT")
+
+	_, err = config.LoadFrom(lookupIn(map[string]string{config.FileEnv: filepath.Join(t.TempDir(), "missing.json")}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"workshop/config"
+	"workshop/credentials"
+	"workshop/logging"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSecretsManager serves whatever secret string it currently holds.
+type fakeSecretsManager struct {
+	mu     sync.Mutex
+	secret string
+	err    error
+	calls  int
+	// deadline is the deadline of the last call's context, if it had one
+	deadline time.Time
+}
+
+func (f *fakeSecretsManager) set(secret string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.secret, f.err = secret, err
+}
+
+func (f *fakeSecretsManager) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.deadline, _ = ctx.Deadline()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: &f.secret}, nil
+}
+
+// lockedBuffer collects log output that may be written from the server's
+// goroutines while the test reads it.
+type lockedBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.String()
+}
+
+// captureLog sends every log record through the redacting writer into a
+// buffer for the rest of the test, as main does with stderr.
+func captureLog(t *testing.T) *lockedBuffer {
+	buffer := &lockedBuffer{}
+	previous, writer, flags := slog.Default(), log.Writer(), log.Flags()
+	slog.SetDefault(logging.New(credentials.RedactingWriter(buffer), slog.LevelDebug))
+	t.Cleanup(func() {
+		// restoring the default slog logger leaves the standard logger alone
+		slog.SetDefault(previous)
+		log.SetOutput(writer)
+		log.SetFlags(flags)
+	})
+	return buffer
+}
+
+func TestSecretsManagerCredentialsRefresh(t *testing.T) {
+	logged := captureLog(t)
+	client := &fakeSecretsManager{}
+	client.set(`{"AWSAccessKeyID": "AKIAFIRSTKEY0001", "AWSSecretAccessKey": "first-secret-access-key"}`, nil)
+	creds := awscredentials.NewCredentials(credentials.NewSecretsManagerProvider(client, "workshop/dynamodb", 20*time.Millisecond))
+
+	value, err := creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIAFIRSTKEY0001", value.AccessKeyID)
+	_, err = creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, client.calls, "Expected the secret to be cached until it is due a refresh")
+	// a hung call gives up rather than holding up every request
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), client.deadline, 5*time.Second)
+
+	// the secret is rotated
+	client.set(`{"AWSAccessKeyID": "AKIASECONDKEY002", "AWSSecretAccessKey": "second-secret-access-key"}`, nil)
+	time.Sleep(30 * time.Millisecond)
+	value, err = creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIASECONDKEY002", value.AccessKeyID)
+	assert.Equal(t, "second-secret-access-key", value.SecretAccessKey)
+
+	// a failed refresh keeps the current credentials
+	client.set("", errors.New("throttled"))
+	time.Sleep(30 * time.Millisecond)
+	value, err = creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIASECONDKEY002", value.AccessKeyID)
+
+	log.Printf("accidentally logged %s and %s", "first-secret-access-key", value.SecretAccessKey)
+	assert.NotContains(t, logged.String(), "first-secret-access-key")
+	assert.NotContains(t, logged.String(), "second-secret-access-key")
+	assert.NotContains(t, logged.String(), "AKIASECONDKEY002")
+	assert.Contains(t, logged.String(), "[REDACTED]")
+	assert.Contains(t, logged.String(), "Y002")
+}
+
+func TestSecretsManagerCredentialsRejectMalformedSecret(t *testing.T) {
+	logged := captureLog(t)
+	client := &fakeSecretsManager{}
+	client.set(`{"AWSAccessKeyID": "AKIATHIRDKEY0003", "AWSSecretAccessKey": ""}`, nil)
+	_, err := awscredentials.NewCredentials(credentials.NewSecretsManagerProvider(client, "workshop/dynamodb", time.Minute)).Get()
+	assert.Error(t, err)
+
+	client.set(`not json but-a-leaked-secret`, nil)
+	_, err = awscredentials.NewCredentials(credentials.NewSecretsManagerProvider(client, "workshop/dynamodb", time.Minute)).Get()
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "but-a-leaked-secret")
+	}
+	assert.NotContains(t, logged.String(), "but-a-leaked-secret")
+}
+
+func TestFileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	write := func(contents string) {
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			log.Fatalf("Failed to write the credentials file in TestFileCredentials: %v", err)
+		}
+	}
+	write(`{"AWSAccessKeyID": "AKIAFILEKEY00001", "AWSSecretAccessKey": "file-secret-access-key"}`)
+
+	cfg := config.Default()
+	cfg.Credentials = config.Credentials{Source: config.CredentialsFile, File: path, Refresh: 20 * time.Millisecond}
+	creds, err := credentials.New(context.Background(), cfg)
+	assert.NoError(t, err)
+	value, err := creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "file-secret-access-key", value.SecretAccessKey)
+
+	write(`{"AWSAccessKeyID": "AKIAFILEKEY00002", "AWSSecretAccessKey": "rotated-file-secret-key", "AWSSessionToken": "file-session-token"}`)
+	time.Sleep(30 * time.Millisecond)
+	value, err = creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIAFILEKEY00002", value.AccessKeyID)
+	assert.Equal(t, "file-session-token", value.SessionToken)
+}
+
+func TestStaticAndDefaultCredentials(t *testing.T) {
+	logged := captureLog(t)
+	cfg := config.Default()
+	cfg.Credentials.Source = config.CredentialsStatic
+	cfg.Credentials.AccessKeyID = "AKIASTATICKEY001"
+	cfg.Credentials.SecretAccessKey = "static-secret-access-key"
+	creds, err := credentials.New(context.Background(), cfg)
+	assert.NoError(t, err)
+	value, err := creds.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "static-secret-access-key", value.SecretAccessKey)
+	log.Println(value)
+	assert.NotContains(t, logged.String(), "static-secret-access-key")
+
+	cfg.Credentials.SecretAccessKey = ""
+	assert.ErrorContains(t, cfg.Validate(), "WORKSHOP_AWS_SECRET_ACCESS_KEY")
+
+	// the default chain is left to the SDK
+	creds, err = credentials.New(context.Background(), config.Default())
+	assert.NoError(t, err)
+	assert.Nil(t, creds)
+}
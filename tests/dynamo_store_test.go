@@ -0,0 +1,374 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"workshop/events"
+	"workshop/models"
+	"workshop/store"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDynamoDB answers the calls a DynamoStore makes for one workshop,
+// keeping the workshop, its registration records and its events as they are
+// written.
+type fakeDynamoDB struct {
+	mu            sync.Mutex
+	workshop      map[string]*dynamodb.AttributeValue
+	registrations map[string]bool
+	outbox        []string
+	// transactions holds the tables written by each TransactWriteItems call,
+	// item by item
+	transactions [][]string
+	// unprocessed is how many more BatchWriteItem calls leave every write
+	// unprocessed, as if throttled
+	unprocessed int
+	// rival, when set, changes the workshop just before the next
+	// TransactWriteItems, as another writer would between the store's read
+	// and its write
+	rival func(workshop *models.Workshop)
+	// reads counts GetItem calls
+	reads int
+	// queries holds each Query made, and listed the workshops they find
+	queries []dynamodb.QueryInput
+	listed  []map[string]*dynamodb.AttributeValue
+}
+
+func (f *fakeDynamoDB) registrationKey(key map[string]*dynamodb.AttributeValue) string {
+	return *key["User_Id"].S + "/" + *key["Workshop_Key"].S
+}
+
+func (f *fakeDynamoDB) writeRegistration(put map[string]*dynamodb.AttributeValue, deleted map[string]*dynamodb.AttributeValue) {
+	if put != nil {
+		f.registrations[f.registrationKey(put)] = true
+	} else {
+		delete(f.registrations, f.registrationKey(deleted))
+	}
+}
+
+// versionMatches reports whether the workshop still has the Version a write
+// is conditional on, as DynamoDB would check it.
+func (f *fakeDynamoDB) versionMatches(put *dynamodb.Put) bool {
+	version, ok := put.ExpressionAttributeValues[":version"]
+	if !ok || f.workshop == nil {
+		return true
+	}
+	current, ok := f.workshop["Version"]
+	return !ok || *current.N == *version.N
+}
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+	var output interface{}
+	switch operation {
+	case "GetItem":
+		f.reads++
+		output = &dynamodb.GetItemOutput{Item: f.workshop}
+	case "Query":
+		var input dynamodb.QueryInput
+		jsonutil.UnmarshalJSON(&input, strings.NewReader(string(body)))
+		f.queries = append(f.queries, input)
+		output = &dynamodb.QueryOutput{Items: f.listed}
+	case "DeleteItem":
+		f.workshop = nil
+		output = &dynamodb.DeleteItemOutput{}
+	case "PutItem":
+		var input dynamodb.PutItemInput
+		jsonutil.UnmarshalJSON(&input, strings.NewReader(string(body)))
+		f.workshop = input.Item
+		output = &dynamodb.PutItemOutput{}
+	case "TransactWriteItems":
+		var input dynamodb.TransactWriteItemsInput
+		jsonutil.UnmarshalJSON(&input, strings.NewReader(string(body)))
+		if f.rival != nil {
+			var workshop models.Workshop
+			dynamodbattribute.UnmarshalMap(f.workshop, &workshop)
+			f.rival(&workshop)
+			f.workshop, _ = dynamodbattribute.MarshalMap(workshop)
+			f.rival = nil
+		}
+		if put := input.TransactItems[0].Put; put != nil && !f.versionMatches(put) {
+			w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"__type": "com.amazonaws.dynamodb.v20120810#TransactionCanceledException", "message": "Transaction cancelled", "CancellationReasons": [{"Code": "ConditionalCheckFailed"}]}`)
+			return
+		}
+		tables := []string{}
+		for _, item := range input.TransactItems {
+			switch {
+			case item.Put != nil && *item.Put.TableName == "workshop":
+				f.workshop = item.Put.Item
+			case item.Put != nil && *item.Put.TableName == "workshop_outbox":
+				f.outbox = append(f.outbox, *item.Put.Item["Type"].S)
+			case item.Put != nil:
+				f.writeRegistration(item.Put.Item, nil)
+			case item.Delete != nil && *item.Delete.TableName == "workshop":
+				f.workshop = nil
+			case item.Delete != nil:
+				f.writeRegistration(nil, item.Delete.Key)
+			}
+			if item.Put != nil {
+				tables = append(tables, *item.Put.TableName)
+			} else {
+				tables = append(tables, *item.Delete.TableName)
+			}
+		}
+		f.transactions = append(f.transactions, tables)
+		output = &dynamodb.TransactWriteItemsOutput{}
+	case "BatchWriteItem":
+		var input dynamodb.BatchWriteItemInput
+		jsonutil.UnmarshalJSON(&input, strings.NewReader(string(body)))
+		if f.unprocessed > 0 {
+			f.unprocessed--
+			output = &dynamodb.BatchWriteItemOutput{UnprocessedItems: input.RequestItems}
+			break
+		}
+		for _, request := range input.RequestItems["workshop_registrations"] {
+			if request.PutRequest != nil {
+				f.writeRegistration(request.PutRequest.Item, nil)
+			} else {
+				f.writeRegistration(nil, request.DeleteRequest.Key)
+			}
+		}
+		output = &dynamodb.BatchWriteItemOutput{}
+	default:
+		http.Error(w, operation, http.StatusBadRequest)
+		return
+	}
+	encoded, _ := jsonutil.BuildJSON(output)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.Write(encoded)
+}
+
+func newFakeDynamoStore(t *testing.T) (*store.DynamoStore, *fakeDynamoDB) {
+	fake := &fakeDynamoDB{registrations: map[string]bool{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("ap-southeast-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: awscredentials.NewStaticCredentials("AKIAFAKE", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	return store.NewDynamoStore(dynamodb.New(sess), store.DynamoTables{Workshops: "workshop", CreatorStartIndex: "Creator_Id-Start_Timestamp-index", Registrations: "workshop_registrations"}), fake
+}
+
+// crowdedWorkshop has the given number of attendees.
+func crowdedWorkshop(attendees int) models.Workshop {
+	workshop := models.Workshop{
+		Workshop_Id:        "crowded",
+		Creator_Id:         "crowded",
+		Creation_Timestamp: "2099-01-01T09:00:00.000Z",
+		Vacancies:          int64(attendees),
+	}
+	for i := 0; i < attendees; i++ {
+		workshop.Attendees = append(workshop.Attendees, fmt.Sprintf("crowd-%d", i))
+	}
+	return workshop
+}
+
+func TestDynamoStoreRefusesChangesTooLargeForATransaction(t *testing.T) {
+	dynamo, fake := newFakeDynamoStore(t)
+
+	// nothing is written rather than only part of it
+	assert.ErrorIs(t, dynamo.Put(context.Background(), crowdedWorkshop(250)), store.ErrTooManyChanges)
+	assert.Nil(t, fake.workshop)
+	assert.Empty(t, fake.registrations)
+	assert.Empty(t, fake.transactions)
+
+	workshop := crowdedWorkshop(90)
+	assert.NoError(t, dynamo.Put(context.Background(), workshop))
+	assert.Len(t, fake.registrations, 90)
+
+	// putting it again with fewer attendees drops the records of the rest
+	workshop.Attendees = workshop.Attendees[:10]
+	assert.NoError(t, dynamo.Put(context.Background(), workshop))
+	assert.Len(t, fake.registrations, 10)
+	for _, tables := range fake.transactions {
+		assert.LessOrEqual(t, len(tables), 100)
+	}
+
+	withdrawn, err := dynamo.Withdraw(context.Background(), "crowded", "2099-01-01T09:00:00.000Z", "crowd-0", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, withdrawn.Promoted)
+	assert.Len(t, fake.registrations, 9)
+}
+
+func TestDynamoStoreDeletesLargeWorkshops(t *testing.T) {
+	ctx := context.Background()
+	dynamo, fake := newFakeDynamoStore(t)
+	workshop := crowdedWorkshop(250)
+	item, err := dynamodbattribute.MarshalMap(workshop)
+	assert.NoError(t, err)
+	fake.workshop = item
+	for _, userID := range workshop.Attendees {
+		fake.registrations[userID+"/crowded#2099-01-01T09:00:00.000Z"] = true
+	}
+
+	// a table that stays throttled fails the delete before the workshop goes
+	fake.unprocessed = 100
+	assert.Error(t, dynamo.Delete(ctx, "crowded", "2099-01-01T09:00:00.000Z", nil))
+	assert.NotNil(t, fake.workshop)
+
+	// deleting again finishes the job, through a few throttled batches
+	fake.unprocessed = 2
+	assert.NoError(t, dynamo.Delete(ctx, "crowded", "2099-01-01T09:00:00.000Z", nil))
+	assert.Nil(t, fake.workshop)
+	assert.Empty(t, fake.registrations)
+	assert.Zero(t, fake.unprocessed)
+	for _, tables := range fake.transactions {
+		assert.LessOrEqual(t, len(tables), 100)
+	}
+}
+
+func TestDynamoStoreRecordsEventsWithTheChange(t *testing.T) {
+	ctx := context.Background()
+	dynamo, fake := newFakeDynamoStore(t)
+	outbox := dynamo.Outbox("workshop_outbox")
+	workshop := models.Workshop{
+		Workshop_Id:           "recorded",
+		Creator_Id:            "recorded",
+		Creation_Timestamp:    "2099-01-01T09:00:00.000Z",
+		Vacancies:             1,
+		Registration_Deadline: "2099-02-08T23:59:59Z",
+		Start_Timestamp:       "2099-02-15T15:00:00Z",
+	}
+
+	assert.NoError(t, dynamo.Create(ctx, workshop))
+	_, err := dynamo.Register(ctx, "recorded", "2099-01-01T09:00:00.000Z", "r1", true, nil)
+	assert.NoError(t, err)
+	_, err = dynamo.Register(ctx, "recorded", "2099-01-01T09:00:00.000Z", "r2", true, nil)
+	assert.NoError(t, err)
+	_, err = dynamo.Withdraw(ctx, "recorded", "2099-01-01T09:00:00.000Z", "r1", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, dynamo.Delete(ctx, "recorded", "2099-01-01T09:00:00.000Z", nil))
+
+	// each change is written in one transaction with its events
+	assert.Equal(t, [][]string{
+		{"workshop", "workshop_outbox"},
+		{"workshop", "workshop_outbox", "workshop_registrations"},
+		{"workshop", "workshop_outbox", "workshop_registrations"},
+		{"workshop", "workshop_outbox", "workshop_outbox", "workshop_registrations", "workshop_registrations"},
+		{"workshop", "workshop_outbox", "workshop_registrations"},
+	}, fake.transactions)
+	assert.Equal(t, []string{
+		events.TypeWorkshopCreated,
+		events.TypeAttendeeRegistered,
+		events.TypeAttendeeRegistered,
+		events.TypeAttendeeWithdrew,
+		events.TypeAttendeeRegistered,
+		events.TypeWorkshopDeleted,
+	}, fake.outbox)
+	assert.Nil(t, fake.workshop)
+	assert.Empty(t, fake.registrations)
+	select {
+	case <-outbox.Recorded():
+	default:
+		t.Fatal("Expected the relay to be woken")
+	}
+}
+
+func TestDynamoStoreRetriesRegistrationsThatLoseARace(t *testing.T) {
+	ctx := context.Background()
+	dynamo, fake := newFakeDynamoStore(t)
+	workshop := models.Workshop{
+		Workshop_Id:           "raced",
+		Creator_Id:            "raced",
+		Creation_Timestamp:    "2099-01-01T09:00:00.000Z",
+		Vacancies:             1,
+		Registration_Deadline: "2099-02-08T23:59:59Z",
+		Start_Timestamp:       "2099-02-15T15:00:00Z",
+	}
+	assert.NoError(t, dynamo.Create(ctx, workshop))
+	fake.reads = 0
+
+	// another writer takes the last seat between the read and the write
+	fake.rival = func(workshop *models.Workshop) {
+		workshop.Attendees = append(workshop.Attendees, "rival")
+		workshop.Vacancies--
+		workshop.Version++
+	}
+	_, err := dynamo.Register(ctx, "raced", "2099-01-01T09:00:00.000Z", "r1", false, nil)
+	assert.ErrorIs(t, err, store.ErrWorkshopFull)
+	// the retry read the workshop again and saw the seat was gone
+	assert.Equal(t, 2, fake.reads)
+	result, err := dynamo.Get(ctx, "raced", "2099-01-01T09:00:00.000Z")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rival"}, result.Attendees)
+	assert.Equal(t, int64(0), result.Vacancies)
+	assert.Empty(t, fake.registrations)
+
+	// one that may wait goes on the waitlist instead of into a seat
+	fake.rival = func(workshop *models.Workshop) { workshop.Version++ }
+	registered, err := dynamo.Register(ctx, "raced", "2099-01-01T09:00:00.000Z", "r2", true, nil)
+	assert.NoError(t, err)
+	assert.True(t, registered.Waitlisted)
+	result, err = dynamo.Get(ctx, "raced", "2099-01-01T09:00:00.000Z")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rival"}, result.Attendees)
+	assert.Equal(t, []string{"r2"}, result.Waitlist)
+	assert.Equal(t, int64(0), result.Vacancies)
+}
+
+func TestDynamoStoreSortsFromTheStartIndex(t *testing.T) {
+	ctx := context.Background()
+	dynamo, fake := newFakeDynamoStore(t)
+	workshop := models.Workshop{
+		Workshop_Id:           "sorted",
+		Creator_Id:            "sorted",
+		Creation_Timestamp:    "2099-01-01T09:00:00.000Z",
+		Registration_Deadline: "2099-02-08T23:59:59.000Z",
+		Start_Timestamp:       "2099-02-15T15:00:00.000Z",
+	}
+	for _, start := range []string{"2099-02-15T15:00:00.000Z", "2099-03-15T15:00:00.000Z"} {
+		workshop.Start_Timestamp = start
+		item, err := dynamodbattribute.MarshalMap(workshop)
+		assert.NoError(t, err)
+		fake.listed = append(fake.listed, item)
+	}
+
+	page, err := dynamo.ListByCreator(ctx, "sorted", store.ListOptions{Sort: store.SortByStartDescending})
+	assert.NoError(t, err)
+	assert.Len(t, page.Workshops, 2)
+	if assert.Len(t, fake.queries, 1) {
+		assert.Equal(t, "Creator_Id-Start_Timestamp-index", aws.StringValue(fake.queries[0].IndexName))
+		assert.False(t, aws.BoolValue(fake.queries[0].ScanIndexForward))
+	}
+
+	// a page of a sorted listing carries on from the index key of the last one
+	page, err = dynamo.ListByCreator(ctx, "sorted", store.ListOptions{Sort: store.SortByStart, Limit: 1})
+	assert.NoError(t, err)
+	page, err = dynamo.ListByCreator(ctx, "sorted", store.ListOptions{Sort: store.SortByStart, NextToken: page.NextToken})
+	assert.NoError(t, err)
+	startKey := fake.queries[len(fake.queries)-1].ExclusiveStartKey
+	if assert.NotNil(t, startKey) {
+		assert.Equal(t, "2099-02-15T15:00:00.000Z", aws.StringValue(startKey["Start_Timestamp"].S))
+	}
+
+	// unsorted tokens do not carry on a sorted listing
+	unsorted, err := dynamo.ListByCreator(ctx, "sorted", store.ListOptions{Limit: 1})
+	assert.NoError(t, err)
+	_, err = dynamo.ListByCreator(ctx, "sorted", store.ListOptions{Sort: store.SortByStart, NextToken: unsorted.NextToken})
+	assert.ErrorIs(t, err, store.ErrInvalidToken)
+
+	// the table has no order across creators, so it is not scanned to sort it
+	_, err = dynamo.List(ctx, store.ListOptions{Sort: store.SortByStart})
+	assert.ErrorIs(t, err, store.ErrSortUnsupported)
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"testing"
+
+	"workshop/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETagAndIfMatch(t *testing.T) {
+	workshop := models.Workshop{
+		Creator_Id:            "etag",
+		Creation_Timestamp:    "2023-11-12-10:00:00.000",
+		Title:                 "Version one",
+		Vacancies:             5,
+		Attendees:             []string{},
+		Registration_Deadline: "2099-02-08-23:59:59.000",
+		Start_Timestamp:       "2099-02-15-15:00:00.000",
+	}
+	if err := testStore.Put(context.Background(), workshop); err != nil {
+		log.Fatalf("Failed to seed the workshop in TestETagAndIfMatch: %v", err)
+	}
+	url := testServer.URL + "/workshop/etag/2023-11-12-10:00:00.000"
+
+	res, body := sendRequest(http.MethodGet, url, nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "Version one", body["Title"])
+	firstETag := res.Header.Get("ETag")
+	assert.NotEmpty(t, firstETag)
+
+	res, _ = sendRequest(http.MethodGet, url, nil, http.Header{"If-None-Match": {firstETag}})
+	assert.Equal(t, 304, res.StatusCode)
+
+	res, _ = sendRequest(http.MethodPatch, url, map[string]interface{}{"Title": "Version two"}, http.Header{"If-Match": {firstETag}})
+	assert.Equal(t, 200, res.StatusCode)
+	secondETag := res.Header.Get("ETag")
+	assert.NotEqual(t, firstETag, secondETag)
+
+	// a second editor still holding the first ETag is turned away on every write
+	stale := http.Header{"If-Match": {firstETag}}
+	res, _ = sendRequest(http.MethodPatch, url, map[string]interface{}{"Title": "Lost update"}, stale)
+	assert.Equal(t, 412, res.StatusCode)
+	res, _ = sendRequest(http.MethodPatch, testServer.URL+"/workshop/register/etag/2023-11-12-10:00:00.000", map[string]interface{}{"User_Id": "e1"}, stale)
+	assert.Equal(t, 412, res.StatusCode)
+	res, _ = sendRequest(http.MethodPatch, testServer.URL+"/workshop/withdraw/etag/2023-11-12-10:00:00.000", map[string]interface{}{"User_Id": "e1"}, stale)
+	assert.Equal(t, 412, res.StatusCode)
+	res, _ = sendRequest(http.MethodDelete, url, nil, stale)
+	assert.Equal(t, 412, res.StatusCode)
+
+	res, body = sendRequest(http.MethodGet, url, nil, nil)
+	assert.Equal(t, "Version two", body["Title"])
+	assert.Equal(t, secondETag, res.Header.Get("ETag"))
+
+	res, _ = sendRequest(http.MethodPatch, testServer.URL+"/workshop/register/etag/2023-11-12-10:00:00.000", map[string]interface{}{"User_Id": "e1"}, http.Header{"If-Match": {`"0", ` + secondETag}})
+	assert.Equal(t, 200, res.StatusCode)
+	res, _ = sendRequest(http.MethodDelete, url, nil, http.Header{"If-Match": {"*"}})
+	assert.Equal(t, 200, res.StatusCode)
+
+	res, _ = sendRequest(http.MethodGet, url, nil, nil)
+	assert.Equal(t, 404, res.StatusCode)
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"workshop/health"
+	"workshop/routes"
+	"workshop/store"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// newHealthServer serves only the probes, backed by the given checks.
+func newHealthServer(ttl time.Duration, checks ...health.Check) *httptest.Server {
+	router := mux.NewRouter()
+	routes.RegisterHealthRoutes(router, health.NewChecker(ttl, checks...))
+	return httptest.NewServer(routes.Middleware(router))
+}
+
+func TestLiveAndReady(t *testing.T) {
+	res, body := sendRequest(http.MethodGet, testServer.URL+"/livez", nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "ok", body["status"])
+
+	res, body = sendRequest(http.MethodGet, testServer.URL+"/readyz", nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "ok", body["status"])
+	assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+	for _, dependency := range body["dependencies"].([]interface{}) {
+		assert.Equal(t, "ok", dependency.(map[string]interface{})["status"])
+	}
+}
+
+func TestReadinessReportsEachDependency(t *testing.T) {
+	logged := captureLog(t)
+	server := newHealthServer(time.Minute,
+		health.Check{Name: "dynamodb:workshop", Run: func(ctx context.Context) error { return nil }},
+		health.Check{Name: "broker", Run: func(ctx context.Context) error {
+			return errors.New("AccessDeniedException: User: arn:aws:sts::123456789012:assumed-role/workshop is not authorized")
+		}},
+	)
+	defer server.Close()
+
+	res, body := sendRequest(http.MethodGet, server.URL+"/readyz", nil, nil)
+	assert.Equal(t, 503, res.StatusCode)
+	assert.Equal(t, "unavailable", body["status"])
+	assert.NotEmpty(t, body["checked_at"])
+	dependencies := body["dependencies"].([]interface{})
+	if assert.Len(t, dependencies, 2) {
+		table := dependencies[0].(map[string]interface{})
+		assert.Equal(t, "dynamodb:workshop", table["name"])
+		assert.Equal(t, "ok", table["status"])
+		assert.Contains(t, table, "latency_ms")
+		assert.NotContains(t, table, "error")
+		broker := dependencies[1].(map[string]interface{})
+		assert.Equal(t, "unavailable", broker["status"])
+		assert.NotContains(t, broker, "error")
+	}
+	// only the log says why
+	assert.Contains(t, logged.String(), "arn:aws:sts::123456789012")
+
+	// liveness does not depend on anything
+	res, _ = sendRequest(http.MethodGet, server.URL+"/livez", nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+}
+
+func TestReadinessIsCachedBriefly(t *testing.T) {
+	var calls int32
+	server := newHealthServer(100*time.Millisecond, health.Check{Name: "counted", Run: func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}})
+	defer server.Close()
+
+	for i := 0; i < 5; i++ {
+		sendRequest(http.MethodGet, server.URL+"/readyz", nil, nil)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	time.Sleep(150 * time.Millisecond)
+	sendRequest(http.MethodGet, server.URL+"/readyz", nil, nil)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestReadinessTimesOutHangingDependencies(t *testing.T) {
+	server := newHealthServer(time.Minute, health.Check{Name: "hanging", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	defer server.Close()
+
+	start := time.Now()
+	res, body := sendRequest(http.MethodGet, server.URL+"/readyz", nil, nil)
+	assert.Equal(t, 503, res.StatusCode)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, "unavailable", body["dependencies"].([]interface{})[0].(map[string]interface{})["status"])
+}
+
+func TestReadinessWithMissingTable(t *testing.T) {
+	if os.Getenv("WORKSHOP_TEST_STORE") != "dynamodb" {
+		t.Skip("needs DynamoDB")
+	}
+	missing := store.NewDynamoStore(svc, store.DynamoTables{
+		Workshops:         "workshop_test_missing",
+		WorkshopIdIndex:   workshopIdIndexName,
+		CreatorStartIndex: creatorStartIndexName,
+		Registrations:     registrationsTableName,
+	})
+	report := health.NewChecker(time.Minute, missing.HealthChecks()...).Report(context.Background())
+	assert.Equal(t, health.StatusUnavailable, report.Status)
+	assert.Equal(t, health.StatusUnavailable, report.Dependencies[0].Status)
+	assert.Equal(t, health.StatusOK, report.Dependencies[1].Status)
+}
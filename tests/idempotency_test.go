@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"workshop/config"
+	"workshop/idempotency"
+	"workshop/routes"
+	"workshop/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unavailableStore fails every registration, as DynamoDB does when throttled.
+type unavailableStore struct {
+	store.WorkshopStore
+}
+
+func (unavailableStore) Register(ctx context.Context, creatorID string, creationTimestamp string, userID string, joinWaitlist bool, pre store.Precondition) (store.RegisterResult, error) {
+	return store.RegisterResult{}, errors.New("ProvisionedThroughputExceededException")
+}
+
+// contendedStore loses the first registration to a concurrent change, as
+// DynamoDB does when a conditional write keeps failing.
+type contendedStore struct {
+	store.WorkshopStore
+	lost atomic.Bool
+}
+
+func (s *contendedStore) Register(ctx context.Context, creatorID string, creationTimestamp string, userID string, joinWaitlist bool, pre store.Precondition) (store.RegisterResult, error) {
+	if s.lost.CompareAndSwap(false, true) {
+		return store.RegisterResult{}, store.ErrConflict
+	}
+	return s.WorkshopStore.Register(ctx, creatorID, creationTimestamp, userID, joinWaitlist, pre)
+}
+
+func workshopsBy(t *testing.T, creatorID string) int {
+	page, err := testStore.ListByCreator(context.Background(), creatorID, store.ListOptions{})
+	assert.NoError(t, err)
+	return len(page.Workshops)
+}
+
+func TestRetriedCreatesAreReplayed(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{Keys: idempotency.New(testIdempotencyStore, time.Hour)})
+	body := `{"Creator_Id": "retrier", "Registration_Deadline": "2099-02-08T23:59:59Z", "Start_Timestamp": "2099-02-15T15:00:00Z"}`
+
+	first := serveRequest(handler, http.MethodPost, "/workshop", body, withKey("create-1"))
+	assert.Equal(t, 201, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+	retry := serveRequest(handler, http.MethodPost, "/workshop", body, withKey("create-1"))
+	assert.Equal(t, 201, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Header().Get("Location"), retry.Header().Get("Location"))
+	assert.Equal(t, first.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+	assert.JSONEq(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, 1, workshopsBy(t, "retrier"))
+
+	// a new key is a new workshop, as is a request without one
+	assert.Equal(t, 201, serveRequest(handler, http.MethodPost, "/workshop", body, withKey("create-2")).Code)
+	assert.Equal(t, 201, serveRequest(handler, http.MethodPost, "/workshop", body).Code)
+	assert.Equal(t, 3, workshopsBy(t, "retrier"))
+}
+
+func TestRetriedRegistrationsAreReplayed(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{Keys: idempotency.New(testIdempotencyStore, time.Hour)})
+	url := seedAuthWorkshop(t, "replay-host")
+
+	for i := 0; i < 2; i++ {
+		rec := serveRequest(handler, http.MethodPatch, url+"/register", `{"User_Id": "flaky-phone"}`, withKey("register-1"))
+		assert.Equal(t, 200, rec.Code, "attempt %d", i+1)
+	}
+	workshop, err := testStore.GetByID(context.Background(), "auth-replay-host")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"flaky-phone"}, workshop.Attendees)
+
+	for i := 0; i < 2; i++ {
+		rec := serveRequest(handler, http.MethodPatch, url+"/withdraw", `{"User_Id": "flaky-phone"}`, withKey("withdraw-1"))
+		assert.Equal(t, 200, rec.Code, "attempt %d", i+1)
+	}
+	// without a key, a retry is a second registration
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url+"/register", `{"User_Id": "steady-phone"}`).Code)
+	assert.Equal(t, 400, serveRequest(handler, http.MethodPatch, url+"/register", `{"User_Id": "steady-phone"}`).Code)
+}
+
+func TestIdempotencyKeysCannotBeReused(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{Keys: idempotency.New(testIdempotencyStore, time.Hour)})
+	url := seedAuthWorkshop(t, "reuse-host")
+
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url+"/register", `{"User_Id": "r1"}`, withKey("reused")).Code)
+	rec := serveRequest(handler, http.MethodPatch, url+"/register", `{"User_Id": "r2"}`, withKey("reused"))
+	assert.Equal(t, 422, rec.Code)
+	assert.Equal(t, "idempotency_key_reused", problemCode(t, rec))
+	// without authentication a key only covers one route
+	rec = serveRequest(handler, http.MethodPatch, url+"/withdraw", `{"User_Id": "r1"}`, withKey("reused"))
+	assert.Equal(t, 200, rec.Code)
+	assert.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+
+	// a retry while the first request is still running is told to wait
+	body := `{"User_Id": "r3"}`
+	_, err := testIdempotencyStore.Claim(context.Background(), idempotency.Record{
+		Key:         "anonymous:running PATCH " + url + "/register",
+		Fingerprint: idempotency.Fingerprint(http.MethodPatch, url+"/register", []byte(body)),
+		Expires_At:  time.Now().Add(time.Minute),
+	})
+	assert.NoError(t, err)
+	rec = serveRequest(handler, http.MethodPatch, url+"/register", body, withKey("running"))
+	assert.Equal(t, 409, rec.Code)
+	assert.Equal(t, "idempotency_key_in_use", problemCode(t, rec))
+
+	rec = serveRequest(handler, http.MethodPatch, url+"/register", body, withKey("not a valid key"))
+	assert.Equal(t, 400, rec.Code)
+}
+
+func TestFailedRequestsCanBeRetried(t *testing.T) {
+	captureLog(t)
+	url := seedAuthWorkshop(t, "throttled-host") + "/register"
+	body := `{"User_Id": "patient"}`
+
+	rec := serveRequest(newHandler(unavailableStore{testStore}, routes.Options{Keys: idempotency.New(testIdempotencyStore, time.Hour)}), http.MethodPatch, url, body, withKey("throttled"))
+	assert.Equal(t, 500, rec.Code)
+	rec = serveRequest(newHandler(testStore, routes.Options{Keys: idempotency.New(testIdempotencyStore, time.Hour)}), http.MethodPatch, url, body, withKey("throttled"))
+	assert.Equal(t, 200, rec.Code)
+	assert.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+}
+
+func TestContendedRequestsCanBeRetried(t *testing.T) {
+	url := seedAuthWorkshop(t, "contended-host") + "/register"
+	body := `{"User_Id": "persistent"}`
+	handler := newHandler(&contendedStore{WorkshopStore: testStore}, routes.Options{Keys: idempotency.New(testIdempotencyStore, time.Hour)})
+
+	rec := serveRequest(handler, http.MethodPatch, url, body, withKey("contended"))
+	assert.Equal(t, 409, rec.Code)
+	assert.Equal(t, "concurrent_modification", problemCode(t, rec))
+	rec = serveRequest(handler, http.MethodPatch, url, body, withKey("contended"))
+	assert.Equal(t, 200, rec.Code)
+	assert.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+
+	// a refusal that will not change on a retry is kept
+	rec = serveRequest(handler, http.MethodPatch, url, body, withKey("duplicate"))
+	assert.Equal(t, "already_registered", problemCode(t, rec))
+	rec = serveRequest(handler, http.MethodPatch, url, body, withKey("duplicate"))
+	assert.Equal(t, "already_registered", problemCode(t, rec))
+	assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotentResponsesExpire(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{Keys: idempotency.New(testIdempotencyStore, time.Millisecond)})
+	body := `{"Creator_Id": "forgetful", "Registration_Deadline": "2099-02-08T23:59:59Z", "Start_Timestamp": "2099-02-15T15:00:00Z"}`
+
+	first := serveRequest(handler, http.MethodPost, "/workshop", body, withKey("short-lived"))
+	assert.Equal(t, 201, first.Code)
+	// DynamoDB counts expiry in whole seconds
+	time.Sleep(1100 * time.Millisecond)
+	later := serveRequest(handler, http.MethodPost, "/workshop", body, withKey("short-lived"))
+	assert.Equal(t, 201, later.Code)
+	assert.NotEqual(t, first.Header().Get("Location"), later.Header().Get("Location"))
+}
+
+func TestIdempotencyKeysBelongToTheirCaller(t *testing.T) {
+	authenticator := newAuthenticator(t, hs256Auth)
+	handler := newHandler(testStore, routes.Options{Authenticator: authenticator, Keys: idempotency.New(testIdempotencyStore, time.Hour)})
+	schedule := `{"Registration_Deadline": "2099-02-08T23:59:59Z", "Start_Timestamp": "2099-02-15T15:00:00Z"}`
+
+	henry := serveRequest(handler, http.MethodPost, "/workshop", schedule, withKey("same-key"), withToken(token(t, "henry")))
+	iris := serveRequest(handler, http.MethodPost, "/workshop", schedule, withKey("same-key"), withToken(token(t, "iris")))
+	assert.Equal(t, 201, henry.Code)
+	assert.Equal(t, 201, iris.Code)
+	assert.Empty(t, iris.Header().Get("Idempotent-Replayed"))
+	assert.NotEqual(t, henry.Header().Get("Location"), iris.Header().Get("Location"))
+
+	// a caller's key covers every route, as it is theirs alone
+	url := henry.Header().Get("Location")
+	rec := serveRequest(handler, http.MethodPatch, url+"/register", "", withKey("same-key"), withToken(token(t, "henry")))
+	assert.Equal(t, 422, rec.Code)
+	assert.Equal(t, "idempotency_key_reused", problemCode(t, rec))
+}
+
+func TestAnonymousIdempotencyKeysOnlyReplayTheSameRequest(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{Keys: idempotency.New(testIdempotencyStore, time.Hour)})
+	schedule := `"Registration_Deadline": "2099-02-08T23:59:59Z", "Start_Timestamp": "2099-02-15T15:00:00Z"`
+
+	first := serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "anonymous-a", `+schedule+`}`, withKey("guessable"))
+	assert.Equal(t, 201, first.Code)
+
+	// another client that happens on the same key learns nothing from it
+	other := serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "anonymous-b", `+schedule+`}`, withKey("guessable"))
+	assert.Equal(t, 422, other.Code)
+	assert.Equal(t, "idempotency_key_reused", problemCode(t, other))
+	assert.Empty(t, other.Header().Get("Location"))
+	assert.Equal(t, 0, workshopsBy(t, "anonymous-b"))
+
+	retry := serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "anonymous-a", `+schedule+`}`, withKey("guessable"))
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Header().Get("Location"), retry.Header().Get("Location"))
+	assert.Equal(t, 1, workshopsBy(t, "anonymous-a"))
+}
+
+func TestIdempotencyConfiguration(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupIn(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "workshop_idempotency", cfg.Idempotency.Table)
+	assert.Equal(t, 24*time.Hour, cfg.Idempotency.TTL)
+
+	cfg, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_IDEMPOTENCY_TTL": "1h"}))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, cfg.Idempotency.TTL)
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_IDEMPOTENCY_TTL": "0s"}))
+	assert.ErrorContains(t, err, "WORKSHOP_IDEMPOTENCY_TTL must be positive")
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_IDEMPOTENCY_TABLE": ""}))
+	assert.ErrorContains(t, err, "WORKSHOP_IDEMPOTENCY_TABLE")
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"workshop/events"
+	"workshop/idempotency"
+	"workshop/models"
+	"workshop/routes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const futureSchedule = `"Registration_Deadline": "2099-02-08T23:59:59Z", "Start_Timestamp": "2099-02-15T15:00:00Z"`
+
+func statusOf(t *testing.T, workshopID string) models.Workshop {
+	workshop, err := testStore.GetByID(context.Background(), workshopID)
+	assert.NoError(t, err)
+	return workshop
+}
+
+func TestWorkshopLifecycle(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{})
+
+	rec := serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "lifecycle", "Vacancies": 5, "Status": "draft", `+futureSchedule+`}`)
+	assert.Equal(t, 201, rec.Code)
+	url := rec.Header().Get("Location")
+	var created map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	workshopID := created["Workshop_Id"]
+	assert.Equal(t, models.StatusDraft, statusOf(t, workshopID).Status)
+
+	steps := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{http.MethodPatch, url + "/register", `{"User_Id": "early"}`, 403, "workshop_not_published"},
+		{http.MethodPatch, url + "/publish", "", 200, ""},
+		{http.MethodPatch, url + "/register", `{"User_Id": "l1"}`, 200, ""},
+		{http.MethodPatch, url + "/register", `{"User_Id": "l2"}`, 200, ""},
+		{http.MethodPatch, url + "/close", "", 200, ""},
+		{http.MethodPatch, url + "/register", `{"User_Id": "late"}`, 403, "registration_closed"},
+		// attendees may still pull out while registration is closed
+		{http.MethodPatch, url + "/withdraw", `{"User_Id": "l2"}`, 200, ""},
+		{http.MethodPatch, url + "/close", "", 409, "invalid_transition"},
+		// publishing again reopens registration
+		{http.MethodPatch, url + "/publish", "", 200, ""},
+		{http.MethodPatch, url + "/register", `{"User_Id": "l3"}`, 200, ""},
+		{http.MethodPatch, url + "/complete", "", 409, "workshop_not_started"},
+		{http.MethodPatch, url + "/cancel", `{"Reason": "The venue flooded"}`, 200, ""},
+		{http.MethodPatch, url + "/register", `{"User_Id": "late"}`, 403, "workshop_cancelled"},
+		{http.MethodPatch, url + "/withdraw", `{"User_Id": "l1"}`, 403, "workshop_cancelled"},
+		{http.MethodPatch, url, `{"Title": "Back on"}`, 403, "workshop_cancelled"},
+		{http.MethodPatch, url + "/publish", "", 409, "invalid_transition"},
+	}
+	for i, step := range steps {
+		rec := serveRequest(handler, step.method, step.path, step.body)
+		assert.Equal(t, step.status, rec.Code, "step %d: %s", i+1, step.path)
+		if step.code != "" {
+			assert.Equal(t, step.code, problemCode(t, rec), "step %d: %s", i+1, step.path)
+		}
+	}
+
+	// cancelling keeps the attendee list, unlike deleting
+	cancelled := statusOf(t, workshopID)
+	assert.Equal(t, models.StatusCancelled, cancelled.Status)
+	assert.Equal(t, []string{"l1", "l3"}, cancelled.Attendees)
+
+	types := []string{}
+	for _, event := range relayedEvents(t, workshopID) {
+		if event.Workshop != nil && event.Type != events.TypeWorkshopCreated {
+			types = append(types, event.Type)
+		}
+	}
+	assert.Equal(t, []string{
+		events.TypeWorkshopPublished,
+		events.TypeWorkshopRegistrationClosed,
+		events.TypeWorkshopPublished,
+		events.TypeWorkshopCancelled,
+	}, types)
+}
+
+func TestOnlyStartedWorkshopsComplete(t *testing.T) {
+	started := models.Workshop{
+		Workshop_Id:        "lifecycle-started",
+		Creator_Id:         "lifecycle-started",
+		Creation_Timestamp: "2023-11-27T10:00:00.000Z",
+		Vacancies:          5,
+		Attendees:          []string{"s1"},
+		Start_Timestamp:    "2023-12-01T10:00:00.000Z",
+	}
+	assert.NoError(t, testStore.Put(context.Background(), started))
+	handler := newHandler(testStore, routes.Options{})
+	url := "/workshop/id/" + started.Workshop_Id
+
+	// a workshop stored without a status is published
+	rec := serveRequest(handler, http.MethodPatch, url+"/complete", "")
+	assert.Equal(t, 200, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"Status":"completed"`)
+	rec = serveRequest(handler, http.MethodPatch, url+"/withdraw", `{"User_Id": "s1"}`)
+	assert.Equal(t, 403, rec.Code)
+	assert.Equal(t, "workshop_completed", problemCode(t, rec))
+	assert.Equal(t, 409, serveRequest(handler, http.MethodPatch, url+"/cancel", `{"Reason": "Too late"}`).Code)
+}
+
+func TestWorkshopsAreCreatedPublished(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{})
+
+	rec := serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "lifecycle-new", `+futureSchedule+`}`)
+	assert.Equal(t, 201, rec.Code)
+	var created map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	assert.Equal(t, models.StatusPublished, statusOf(t, created["Workshop_Id"]).Status)
+
+	rec = serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "lifecycle-new", "Status": "cancelled", `+futureSchedule+`}`)
+	assert.Equal(t, 400, rec.Code)
+	rec = serveRequest(handler, http.MethodPatch, "/workshop/id/"+created["Workshop_Id"], `{"Status": "draft"}`)
+	assert.Equal(t, 400, rec.Code)
+	assert.Contains(t, rec.Body.String(), "publish, close, cancel and complete")
+}
+
+func TestListingByStatus(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{})
+	for _, status := range []string{"draft", "published", "draft"} {
+		rec := serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "lifecycle-listed", "Status": "`+status+`", `+futureSchedule+`}`)
+		assert.Equal(t, 201, rec.Code)
+	}
+
+	count := func(query string) int {
+		rec := serveRequest(handler, http.MethodGet, "/workshop/lifecycle-listed"+query, "")
+		assert.Equal(t, 200, rec.Code, query)
+		var listed []models.Workshop
+		json.Unmarshal(rec.Body.Bytes(), &listed)
+		return len(listed)
+	}
+	assert.Equal(t, 3, count(""))
+	assert.Equal(t, 2, count("?status=draft"))
+	assert.Equal(t, 1, count("?status=published"))
+	assert.Equal(t, 3, count("?status=draft,%20published"))
+	assert.Equal(t, 0, count("?status=cancelled"))
+
+	// seeded workshops have no status of their own, and count as published
+	rec := serveRequest(handler, http.MethodGet, "/workshop/1?status=published", "")
+	assert.Contains(t, rec.Body.String(), "Mr Lee fan repair!")
+
+	rec = serveRequest(handler, http.MethodGet, "/workshop?status=archived", "")
+	assert.Equal(t, 400, rec.Code)
+}
+
+func TestOnlyCreatorsChangeTheStatus(t *testing.T) {
+	authenticator := newAuthenticator(t, hs256Auth)
+	handler := newHandler(testStore, routes.Options{Authenticator: authenticator, Keys: idempotency.New(testIdempotencyStore, 0)})
+	url := seedAuthWorkshop(t, "lifecycle-owner")
+
+	assert.Equal(t, 401, serveRequest(handler, http.MethodPatch, url+"/cancel", `{"Reason": "Moderated"}`).Code)
+	assert.Equal(t, 403, serveRequest(handler, http.MethodPatch, url+"/cancel", `{"Reason": "Moderated"}`, withToken(token(t, "intruder"))).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url+"/close", "", withToken(token(t, "lifecycle-owner"))).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url+"/cancel", `{"Reason": "Moderated"}`, withToken(token(t, "support", "admin"))).Code)
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+
+	"workshop/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var listingSeedData = []models.Workshop{
+	{Creator_Id: "listing", Creation_Timestamp: "2023-11-09-10:00:00.001", Title: "Compost basics", Location: "Tampines Hub", Vacancies: 3, Registration_Deadline: "2099-03-01-00:00:00.000", Start_Timestamp: "2099-03-02-10:00:00.000"},
+	{Creator_Id: "listing", Creation_Timestamp: "2023-11-09-10:00:00.002", Title: "Advanced composting", Location: "tampines hub", Vacancies: 0, Registration_Deadline: "2099-01-01-00:00:00.000", Start_Timestamp: "2099-01-02-10:00:00.000"},
+	{Creator_Id: "listing", Creation_Timestamp: "2023-11-09-10:00:00.003", Title: "Fan repair", Location: "123 Example Road", Vacancies: 5, Registration_Deadline: "2099-02-01-00:00:00.000", Start_Timestamp: "2099-02-02-10:00:00.000"},
+	{Creator_Id: "listing", Creation_Timestamp: "2023-11-09-10:00:00.004", Title: "Past swap meet", Location: "Tampines Hub", Vacancies: 2, Registration_Deadline: "2023-01-01-00:00:00.000", Start_Timestamp: "2023-01-02-10:00:00.000"},
+}
+
+// getListing fetches a listing and returns the status, the workshops and the
+// token for the next page
+func getListing(path string) (int, []models.Workshop, string) {
+	res, err := http.Get(testServer.URL + path)
+	if err != nil {
+		log.Fatalf("Failed to send the HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+	var workshops []models.Workshop
+	if res.StatusCode == 200 {
+		if err := json.NewDecoder(res.Body).Decode(&workshops); err != nil {
+			log.Fatalf("Failed to decode the response body: %v", err)
+		}
+	}
+	return res.StatusCode, workshops, res.Header.Get("X-Next-Token")
+}
+
+func titles(workshops []models.Workshop) []string {
+	result := []string{}
+	for _, workshop := range workshops {
+		result = append(result, workshop.Title)
+	}
+	return result
+}
+
+func TestListingFiltersAndSort(t *testing.T) {
+	for _, workshop := range listingSeedData {
+		if err := testStore.Put(context.Background(), workshop); err != nil {
+			log.Fatalf("Failed to seed the workshop in TestListingFiltersAndSort: %v", err)
+		}
+	}
+
+	_, workshops, _ := getListing("/workshop/listing?location=TAMPINES%20HUB&sort=start")
+	assert.Equal(t, []string{"Past swap meet", "Advanced composting", "Compost basics"}, titles(workshops))
+
+	_, workshops, _ = getListing("/workshop/listing?title=compost&has_vacancy=true")
+	assert.Equal(t, []string{"Compost basics"}, titles(workshops))
+
+	_, workshops, _ = getListing("/workshop/listing?when=upcoming&sort=-start")
+	assert.Equal(t, []string{"Compost basics", "Fan repair", "Advanced composting"}, titles(workshops))
+
+	_, workshops, _ = getListing("/workshop/listing?when=past")
+	assert.Equal(t, []string{"Past swap meet"}, titles(workshops))
+
+	for _, query := range []string{"limit=0", "limit=abc", "when=soon", "sort=title", "has_vacancy=maybe", "next_token=not-a-token"} {
+		status, _, _ := getListing("/workshop/listing?" + query)
+		assert.Equal(t, 400, status, "Expected %s to be rejected", query)
+	}
+}
+
+func TestListingPagination(t *testing.T) {
+	for _, workshop := range listingSeedData {
+		if err := testStore.Put(context.Background(), workshop); err != nil {
+			log.Fatalf("Failed to seed the workshop in TestListingPagination: %v", err)
+		}
+	}
+
+	for _, sort := range []string{"", "&sort=start"} {
+		if sort != "" && os.Getenv("WORKSHOP_TEST_STORE") == "dynamodb" {
+			// DynamoDB only sorts one creator's workshops
+			status, _, _ := getListing("/workshop?limit=2" + sort)
+			assert.Equal(t, 400, status)
+			continue
+		}
+		_, everything, nextToken := getListing("/workshop?limit=100" + sort)
+		assert.Equal(t, "", nextToken)
+
+		paged := []models.Workshop{}
+		path := "/workshop?limit=2" + sort
+		for {
+			status, workshops, nextToken := getListing(path)
+			assert.Equal(t, 200, status)
+			assert.LessOrEqual(t, len(workshops), 2)
+			paged = append(paged, workshops...)
+			if nextToken == "" {
+				break
+			}
+			path = "/workshop?limit=2" + sort + "&next_token=" + nextToken
+		}
+		assert.Equal(t, everything, paged)
+	}
+
+	status, workshops, nextToken := getListing("/workshop/listing?limit=3&sort=start")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []string{"Past swap meet", "Advanced composting", "Fan repair"}, titles(workshops))
+	_, workshops, nextToken = getListing("/workshop/listing?limit=3&sort=start&next_token=" + nextToken)
+	assert.Equal(t, []string{"Compost basics"}, titles(workshops))
+	assert.Equal(t, "", nextToken)
+}
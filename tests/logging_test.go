@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"workshop/config"
+	"workshop/logging"
+	"workshop/models"
+	"workshop/routes"
+	"workshop/store"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// logRecords decodes the JSON log lines in logged that carry requestID.
+func logRecords(t *testing.T, logged string, requestID string) []map[string]interface{} {
+	records := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(logged), "\n") {
+		var record map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal([]byte(line), &record), line) {
+			continue
+		}
+		if record["request_id"] == requestID {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestRequestsAreLoggedWithTheirID(t *testing.T) {
+	logged := captureLog(t)
+	handler := newHandler(testStore, routes.Options{})
+
+	req := httptest.NewRequest(http.MethodGet, "/workshop/id/no-such-workshop", nil)
+	req.Header.Set("X-Request-ID", "logged-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "logged-1", rec.Header().Get("X-Request-Id"))
+	assert.Contains(t, rec.Body.String(), `"request_id":"logged-1"`)
+
+	records := logRecords(t, logged.String(), "logged-1")
+	if assert.Len(t, records, 1) {
+		record := records[0]
+		assert.Equal(t, "INFO", record["level"])
+		assert.Equal(t, "request served", record["msg"])
+		assert.Equal(t, "GET", record["method"])
+		assert.Equal(t, "/workshop/id/{id}", record["route"])
+		assert.Equal(t, float64(404), record["status"])
+		assert.Contains(t, record, "duration_ms")
+	}
+	assert.NotContains(t, logged.String(), "no-such-workshop")
+}
+
+func TestUserIDsAreNotLogged(t *testing.T) {
+	logged := captureLog(t)
+	handler := newHandler(testStore, routes.Options{})
+	workshop := models.Workshop{
+		Creator_Id:            "pii-creator",
+		Creation_Timestamp:    "2023-11-23T10:00:00.000Z",
+		Vacancies:             1,
+		Attendees:             []string{},
+		Registration_Deadline: "2099-02-08T23:59:59.000Z",
+		Start_Timestamp:       "2099-02-15T15:00:00.000Z",
+	}
+	if err := testStore.Put(context.Background(), workshop); err != nil {
+		t.Fatalf("Failed to seed the workshop in TestUserIDsAreNotLogged: %v", err)
+	}
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPatch, "/workshop/register/pii-creator/2023-11-23T10:00:00.000Z", strings.NewReader(`{"User_Id": "alice-pii-123"}`)),
+		httptest.NewRequest(http.MethodGet, "/users/alice-pii-123/registrations", nil),
+		httptest.NewRequest(http.MethodPatch, "/workshop/withdraw/pii-creator/2023-11-23T10:00:00.000Z", strings.NewReader(`{"User_Id": "alice-pii-123"}`)),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Less(t, rec.Code, 300, req.URL.Path)
+	}
+
+	assert.NotContains(t, logged.String(), "alice-pii-123")
+	assert.NotContains(t, logged.String(), "pii-creator")
+	// the same user gets the same pseudonym, so their requests can be followed
+	pseudonym := logging.Pseudonym("alice-pii-123")
+	assert.Equal(t, 2, strings.Count(logged.String(), `"user_id":"`+pseudonym+`"`))
+	assert.Contains(t, logged.String(), `"route":"/users/{user_id}/registrations"`)
+}
+
+func TestLogLevels(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := logging.New(&buffer, logging.ParseLevel(config.LogLevelWarn))
+	logger.Info("not shown")
+	logger.Warn("shown", "User_Id", "bob")
+	assert.NotContains(t, buffer.String(), "not shown")
+	assert.Contains(t, buffer.String(), `"level":"WARN"`)
+	assert.Contains(t, buffer.String(), logging.Pseudonym("bob"))
+	assert.NotContains(t, buffer.String(), `"bob"`)
+
+	assert.Equal(t, slog.LevelDebug, logging.ParseLevel(config.LogLevelDebug))
+	assert.Equal(t, slog.LevelError, logging.ParseLevel(config.LogLevelError))
+	assert.Equal(t, slog.LevelInfo, logging.ParseLevel("chatty"))
+}
+
+func TestDynamoDBBodiesAreNeverLogged(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_LOG_LEVEL": "debug"}))
+	assert.NoError(t, err)
+	level := cfg.AWSConfig().LogLevel
+	assert.True(t, level.AtLeast(aws.LogDebug))
+	assert.False(t, level.Matches(aws.LogDebugWithHTTPBody))
+}
+
+// unlistableStore fails every listing by creator, as DynamoDB does when the
+// index is missing.
+type unlistableStore struct {
+	store.WorkshopStore
+}
+
+func (unlistableStore) ListByCreator(ctx context.Context, creatorID string, opts store.ListOptions) (store.Page, error) {
+	return store.Page{}, errors.New("ResourceNotFoundException")
+}
+
+func TestFailedQueriesDoNotLogTheCreator(t *testing.T) {
+	logged := captureLog(t)
+
+	rec := serveRequest(newHandler(unlistableStore{testStore}, routes.Options{}), http.MethodGet, "/workshop/pii-lister", "")
+	assert.Equal(t, 500, rec.Code)
+	assert.Contains(t, logged.String(), "ResourceNotFoundException")
+	assert.NotContains(t, logged.String(), "pii-lister")
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"workshop/metrics"
+	"workshop/store"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrapeMetrics(t *testing.T) string {
+	res, err := http.Get(testServer.URL + "/metrics")
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	return string(body)
+}
+
+func TestRequestMetricsUseRouteTemplates(t *testing.T) {
+	byID := metrics.HTTPRequests.WithLabelValues("GET", "/workshop/id/{id}", "404")
+	unmatched := metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404")
+	before, beforeUnmatched := testutil.ToFloat64(byID), testutil.ToFloat64(unmatched)
+
+	sendRequest(http.MethodGet, testServer.URL+"/workshop/id/no-such-workshop", nil, nil)
+	sendRequest(http.MethodGet, testServer.URL+"/workshop/id/nor-this-one", nil, nil)
+	sendRequest(http.MethodGet, testServer.URL+"/no/such/route/at/all", nil, nil)
+
+	assert.Equal(t, before+2, testutil.ToFloat64(byID))
+	assert.Equal(t, beforeUnmatched+1, testutil.ToFloat64(unmatched))
+
+	scraped := scrapeMetrics(t)
+	assert.Contains(t, scraped, `workshop_http_requests_total{method="GET",route="/workshop/id/{id}",status="404"}`)
+	assert.Contains(t, scraped, `workshop_http_request_duration_seconds_bucket{method="GET",route="/workshop/id/{id}"`)
+	assert.NotContains(t, scraped, "no-such-workshop")
+	assert.NotContains(t, scraped, "/no/such/route")
+	assert.Contains(t, scraped, "go_goroutines")
+}
+
+func TestDomainMetrics(t *testing.T) {
+	created := testutil.ToFloat64(metrics.WorkshopsCreated)
+	attendees := testutil.ToFloat64(metrics.Registrations.WithLabelValues(metrics.OutcomeAttendee))
+	waitlisted := testutil.ToFloat64(metrics.Registrations.WithLabelValues(metrics.OutcomeWaitlisted))
+	rejected := testutil.ToFloat64(metrics.RegistrationsRejectedFull)
+	withdrawals := testutil.ToFloat64(metrics.Withdrawals)
+
+	res, body := sendRequest(http.MethodPost, testServer.URL+"/workshop", map[string]interface{}{
+		"Creator_Id":            "metrics",
+		"Title":                 "Counted",
+		"Vacancies":             1,
+		"Registration_Deadline": "2099-02-08-23:59:59.000",
+		"Start_Timestamp":       "2099-02-15-15:00:00.000",
+	}, nil)
+	assert.Equal(t, 201, res.StatusCode)
+	url := testServer.URL + "/workshop/id/" + body["Workshop_Id"].(string)
+
+	res, _ = sendPatch(url+"/register", map[string]interface{}{"User_Id": "m1"})
+	assert.Equal(t, 200, res.StatusCode)
+	res, _ = sendPatch(url+"/register?waitlist=false", map[string]interface{}{"User_Id": "m2"})
+	assert.Equal(t, 409, res.StatusCode)
+	res, _ = sendPatch(url+"/register", map[string]interface{}{"User_Id": "m2"})
+	assert.Equal(t, 202, res.StatusCode)
+	res, _ = sendPatch(url+"/withdraw", map[string]interface{}{"User_Id": "m1"})
+	assert.Equal(t, 200, res.StatusCode)
+	// failed withdrawals are not counted
+	res, _ = sendPatch(url+"/withdraw", map[string]interface{}{"User_Id": "m3"})
+	assert.Equal(t, 400, res.StatusCode)
+
+	assert.Equal(t, created+1, testutil.ToFloat64(metrics.WorkshopsCreated))
+	assert.Equal(t, attendees+1, testutil.ToFloat64(metrics.Registrations.WithLabelValues(metrics.OutcomeAttendee)))
+	assert.Equal(t, waitlisted+1, testutil.ToFloat64(metrics.Registrations.WithLabelValues(metrics.OutcomeWaitlisted)))
+	assert.Equal(t, rejected+1, testutil.ToFloat64(metrics.RegistrationsRejectedFull))
+	assert.Equal(t, withdrawals+1, testutil.ToFloat64(metrics.Withdrawals))
+}
+
+func TestDynamoDBMetrics(t *testing.T) {
+	// nothing listens on this port, so every call fails without retrying
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("ap-southeast-1"),
+		Endpoint:    aws.String("http://127.0.0.1:1"),
+		Credentials: awscredentials.NewStaticCredentials("AKIAMETRICS", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	client := dynamodb.New(sess)
+	unreachable := store.NewDynamoStore(client, store.DynamoTables{Workshops: "workshop", Registrations: "workshop_registrations"})
+	// a second store on the same client does not count calls twice
+	store.NewDynamoStore(client, store.DynamoTables{Workshops: "workshop", Registrations: "workshop_registrations"})
+
+	errorsBefore := testutil.ToFloat64(metrics.DynamoDBErrors.WithLabelValues("GetItem", "RequestError"))
+	_, err := unreachable.Get(context.Background(), "1", "2023-11-04-03:28:10.244")
+	assert.Error(t, err)
+	assert.Equal(t, errorsBefore+1, testutil.ToFloat64(metrics.DynamoDBErrors.WithLabelValues("GetItem", "RequestError")))
+
+	scraped := scrapeMetrics(t)
+	assert.Contains(t, scraped, `workshop_dynamodb_request_duration_seconds_count{operation="GetItem"}`)
+	assert.Contains(t, scraped, `workshop_dynamodb_errors_total{code="RequestError",operation="GetItem"}`)
+}
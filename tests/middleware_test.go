@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"workshop/auth"
+	"workshop/config"
+	"workshop/routes"
+	"workshop/store"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenConnection is a response writer whose client has gone away.
+type brokenConnection struct {
+	header http.Header
+	status int
+}
+
+func (b *brokenConnection) Header() http.Header {
+	if b.header == nil {
+		b.header = http.Header{}
+	}
+	return b.header
+}
+
+func (b *brokenConnection) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *brokenConnection) Write(p []byte) (int, error) {
+	return 0, errors.New("write: broken pipe")
+}
+
+// panickingStore panics on every listing.
+type panickingStore struct {
+	store.WorkshopStore
+}
+
+func (panickingStore) List(ctx context.Context, opts store.ListOptions) (store.Page, error) {
+	panic("listing exploded")
+}
+
+// newHandler serves the routes for workshops, with the features opts sets
+// turned on.
+func newHandler(workshops store.WorkshopStore, opts routes.Options) http.Handler {
+	router := mux.NewRouter()
+	routes.RegisterRoutes(router, workshops, opts)
+	return routes.Middleware(router)
+}
+
+// newAuthenticator checks bearer tokens as cfg says.
+func newAuthenticator(t *testing.T, cfg config.Auth) *auth.Authenticator {
+	authenticator, err := auth.New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to set up authentication: %v", err)
+	}
+	return authenticator
+}
+
+// requestOption adds to a request before serveRequest sends it.
+type requestOption func(req *http.Request)
+
+// withToken sends token as a bearer token.
+func withToken(token string) requestOption {
+	return withHeader("Authorization", "Bearer "+token)
+}
+
+// withKey sends an Idempotency-Key.
+func withKey(key string) requestOption {
+	return withHeader("Idempotency-Key", key)
+}
+
+func withHeader(name string, value string) requestOption {
+	return func(req *http.Request) {
+		req.Header.Set(name, value)
+	}
+}
+
+// from sends the request as if from remoteAddr.
+func from(remoteAddr string) requestOption {
+	return func(req *http.Request) {
+		req.RemoteAddr = remoteAddr
+	}
+}
+
+func serveRequest(handler http.Handler, method string, url string, body string, options ...requestOption) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	for _, option := range options {
+		option(req)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBrokenClientConnectionsAreLogged(t *testing.T) {
+	logged := captureLog(t)
+	handler := newHandler(testStore, routes.Options{})
+
+	// every kind of response, none of which may take the process down
+	for _, path := range []string{"/health", "/workshop", "/workshop/2/2023-10-20-21:22:22.080", "/workshop/nobody/nothing"} {
+		conn := &brokenConnection{}
+		handler.ServeHTTP(conn, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.NotZero(t, conn.status, "Expected a status for %s", path)
+	}
+	assert.Equal(t, 4, strings.Count(logged.String(), "could not write the response"))
+	assert.Contains(t, logged.String(), "broken pipe")
+
+	res, _ := sendRequest(http.MethodGet, testServer.URL+"/health", nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+}
+
+func TestClientHangingUpMidRequest(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(testServer.URL, "http://"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		conn.Write([]byte("GET /workshop?limit=100 HTTP/1.1\r\nHost: workshop\r\n\r\n"))
+		conn.Close()
+	}
+
+	res, body := sendRequest(http.MethodGet, testServer.URL+"/health", nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "Service is healthy", body["message"])
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+}
+
+func TestPanicsBecomeInternalErrors(t *testing.T) {
+	logged := captureLog(t)
+	server := httptest.NewServer(newHandler(panickingStore{testStore}, routes.Options{}))
+	defer server.Close()
+
+	res, body := sendRequest(http.MethodGet, server.URL+"/workshop", nil, http.Header{"X-Request-Id": {"panic-1"}})
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Equal(t, "internal", body["code"])
+	assert.Equal(t, "panic-1", body["request_id"])
+	assert.NotContains(t, body["detail"], "exploded")
+	assert.Contains(t, logged.String(), "panic-1")
+	assert.Contains(t, logged.String(), "listing exploded")
+
+	// the server carries on with other requests
+	res, _ = sendRequest(http.MethodGet, server.URL+"/workshop/2/2023-10-20-21:22:22.080", nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+}
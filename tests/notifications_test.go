@@ -0,0 +1,334 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"workshop/config"
+	"workshop/events"
+	"workshop/metrics"
+	"workshop/models"
+	"workshop/notify"
+	"workshop/routes"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingNotifier keeps the notices it is sent, and fails those to the
+// users in fail as often as it says.
+type recordingNotifier struct {
+	mu      sync.Mutex
+	notices []notify.Notice
+	fail    map[string]int
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notice notify.Notice) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fail[notice.User_Id] > 0 {
+		n.fail[notice.User_Id] -= 1
+		return errors.New("mailbox full")
+	}
+	n.notices = append(n.notices, notice)
+	return nil
+}
+
+// sent returns the notices about workshopID sent so far.
+func (n *recordingNotifier) sent(workshopID string) []notify.Notice {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sent := []notify.Notice{}
+	for _, notice := range n.notices {
+		if notice.Workshop_Id == workshopID {
+			sent = append(sent, notice)
+		}
+	}
+	return sent
+}
+
+// seedFullWorkshop stores a published workshop with two attendees and one
+// user on its waitlist, and returns its URL.
+func seedFullWorkshop(t *testing.T, workshopID string) string {
+	err := testStore.Put(context.Background(), models.Workshop{
+		Workshop_Id:           workshopID,
+		Creator_Id:            workshopID,
+		Creation_Timestamp:    "2099-01-01T09:00:00.000Z",
+		Title:                 "Bicycle repair",
+		Vacancies:             0,
+		Attendees:             []string{"ann", "ben"},
+		Waitlist:              []string{"cat"},
+		Registration_Deadline: "2099-02-08T23:59:59Z",
+		Start_Timestamp:       "2099-02-15T15:00:00Z",
+		Time_Zone:             models.DefaultTimeZone,
+		Status:                models.StatusPublished,
+	})
+	assert.NoError(t, err)
+	return "/workshop/id/" + workshopID
+}
+
+func TestCancellingTellsEveryone(t *testing.T) {
+	notifier := &recordingNotifier{}
+	notices := notify.NewDispatcher(notifier, time.Second)
+	handler := newHandler(testStore, routes.Options{})
+	url := seedFullWorkshop(t, "cancelled-repair")
+
+	for _, body := range []string{`{}`, `{"Reason": "   "}`, `{"Reason": "` + strings.Repeat("x", models.MaxReasonLength+1) + `"}`} {
+		rec := serveRequest(handler, http.MethodPatch, url+"/cancel", body)
+		assert.Equal(t, 400, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), "Reason must be between 1 and 500 characters")
+	}
+	assert.Equal(t, 400, serveRequest(handler, http.MethodPatch, url+"/cancel", "").Code)
+
+	rec := serveRequest(handler, http.MethodPatch, url+"/cancel", `{"Reason": " The mechanic is ill "}`)
+	assert.Equal(t, 200, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("ETag"))
+	assert.JSONEq(t, `{"message": "Workshop cancelled successfully.", "Status": "cancelled"}`, rec.Body.String())
+
+	// the notices go out once the cancellation's event is relayed
+	assert.Empty(t, notifier.sent("cancelled-repair"))
+	assert.NoError(t, relayTo(notices))
+	sent := notifier.sent("cancelled-repair")
+	assert.Len(t, sent, 3)
+	told := map[string]bool{}
+	for _, notice := range sent {
+		told[notice.User_Id] = notice.Waitlisted
+		assert.Equal(t, events.TypeWorkshopCancelled, notice.Type)
+		assert.Equal(t, "Bicycle repair", notice.Title)
+		assert.Equal(t, "The mechanic is ill", notice.Reason)
+	}
+	assert.Equal(t, map[string]bool{"ann": false, "ben": false, "cat": true}, told)
+
+	// the workshop is kept, with its attendees and the reason
+	workshop := statusOf(t, "cancelled-repair")
+	assert.Equal(t, models.StatusCancelled, workshop.Status)
+	assert.Equal(t, "The mechanic is ill", workshop.Cancellation_Reason)
+	assert.Equal(t, []string{"ann", "ben"}, workshop.Attendees)
+
+	rec = serveRequest(handler, http.MethodPatch, url+"/register", `{"User_Id": "dan"}`)
+	assert.Equal(t, 403, rec.Code)
+	assert.Equal(t, "workshop_cancelled", problemCode(t, rec))
+	rec = serveRequest(handler, http.MethodPatch, url+"/cancel", `{"Reason": "Again"}`)
+	assert.Equal(t, 409, rec.Code)
+	assert.Equal(t, "invalid_transition", problemCode(t, rec))
+	rec = serveRequest(handler, http.MethodPatch, url, `{"Cancellation_Reason": "Rewritten"}`)
+	assert.Equal(t, 400, rec.Code)
+	assert.NoError(t, relayTo(notices))
+	assert.Len(t, notifier.sent("cancelled-repair"), 3)
+}
+
+func TestFailedNoticesAreRetried(t *testing.T) {
+	captureLog(t)
+	notifier := &recordingNotifier{fail: map[string]int{"ben": 2}}
+	notices := notify.NewDispatcher(notifier, time.Second)
+	url := seedFullWorkshop(t, "retold-repair")
+
+	rec := serveRequest(newHandler(testStore, routes.Options{}), http.MethodPatch, url+"/cancel", `{"Reason": "Rained off"}`)
+	assert.Equal(t, 200, rec.Code)
+
+	// the event stays in the outbox until ben is told, and the others are
+	// not told twice
+	assert.Error(t, relayTo(notices))
+	assert.Len(t, notifier.sent("retold-repair"), 2)
+	assert.Error(t, relayTo(notices))
+	assert.NoError(t, relayTo(notices))
+	told := []string{}
+	for _, notice := range notifier.sent("retold-repair") {
+		told = append(told, notice.User_Id)
+	}
+	assert.ElementsMatch(t, []string{"ann", "ben", "cat"}, told)
+	assert.NoError(t, relayTo(notices))
+	assert.Len(t, notifier.sent("retold-repair"), 3)
+}
+
+func TestFailedNoticesAreGivenUpOn(t *testing.T) {
+	logged := captureLog(t)
+	notifier := &recordingNotifier{fail: map[string]int{"ben": 100}}
+	notices := notify.NewDispatcher(notifier, time.Second)
+	url := seedFullWorkshop(t, "half-told-repair")
+	failed := testutil.ToFloat64(metrics.NotificationErrors.WithLabelValues(events.TypeWorkshopCancelled))
+
+	rec := serveRequest(newHandler(testStore, routes.Options{}), http.MethodPatch, url+"/cancel", `{"Reason": "Rained off"}`)
+	assert.Equal(t, 200, rec.Code)
+	attempts := 1
+	for ; relayTo(notices) != nil && attempts < 10; attempts++ {
+	}
+
+	// one notice that keeps failing does not hold up the outbox for good
+	assert.Less(t, attempts, 10)
+	assert.Len(t, notifier.sent("half-told-repair"), 2)
+	assert.Equal(t, failed+1, testutil.ToFloat64(metrics.NotificationErrors.WithLabelValues(events.TypeWorkshopCancelled)))
+	assert.Contains(t, logged.String(), "could not send a notice, will retry")
+	assert.Contains(t, logged.String(), "could not send a notice, giving up")
+	assert.Contains(t, logged.String(), "mailbox full")
+	assert.NotContains(t, logged.String(), `"ben"`)
+}
+
+func TestWebhookNotices(t *testing.T) {
+	var body []byte
+	var signature string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(notify.SignatureHeader)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	notice := notify.WorkshopCancelled(models.Workshop{Workshop_Id: "hooked", Attendees: []string{"ann"}, Cancellation_Reason: "Flooded"})[0]
+
+	webhook := notify.NewWebhook(server.URL+"/notices", "webhook-secret")
+	assert.NoError(t, webhook.Notify(context.Background(), notice))
+	var received notify.Notice
+	assert.NoError(t, json.Unmarshal(body, &received))
+	assert.Equal(t, notice, received)
+	mac := hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write(body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), signature)
+
+	// unsigned without a secret, and failed unless the answer is a 2xx
+	assert.NoError(t, notify.NewWebhook(server.URL, "").Notify(context.Background(), notice))
+	assert.Empty(t, signature)
+	status = http.StatusBadGateway
+	assert.ErrorContains(t, webhook.Notify(context.Background(), notice), "the webhook answered 502")
+}
+
+// fakeSMTP accepts one message on a local port, as a stand-in for a mail
+// server, and hands on the recipient and the message.
+func fakeSMTP(t *testing.T) (string, <-chan [2]string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	received := make(chan [2]string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ready")
+		var recipient string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				recipient = strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 go ahead")
+				var message strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					message.WriteString(line)
+				}
+				received <- [2]string{recipient, message.String()}
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestSMTPNotices(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	cfg := config.Default().Notifications
+	cfg.Notifier = config.NotifierSMTP
+	cfg.SMTPAddr = addr
+	cfg.SMTPRecipientDomain = "example.com"
+	notice := notify.WorkshopCancelled(models.Workshop{
+		Title:               "Café\r\nBcc: everyone@example.com",
+		Attendees:           []string{"ann"},
+		Start_Timestamp:     "2099-02-15T15:00:00Z",
+		Cancellation_Reason: "The roof leaks",
+	})[0]
+
+	smtp := notify.New(cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, smtp.Notify(ctx, notice))
+	mail := <-received
+	assert.Equal(t, "ann@example.com", mail[0])
+	assert.Contains(t, mail[1], "To: <ann@example.com>\r\n")
+	assert.Contains(t, mail[1], "Subject: =?utf-8?q?")
+	// the title cannot add headers of its own
+	assert.NotContains(t, mail[1], "\r\nBcc:")
+	assert.Contains(t, mail[1], "The reason given was: The roof leaks")
+	assert.Contains(t, mail[1], "2099-02-15T15:00:00Z")
+
+	// user IDs that are not addresses need a domain to become one
+	cfg.SMTPRecipientDomain = ""
+	assert.ErrorContains(t, notify.New(cfg).Notify(ctx, notice), "WORKSHOP_SMTP_RECIPIENT_DOMAIN")
+	notice.User_Id = "ann <ann@example.com>"
+	assert.ErrorContains(t, notify.New(cfg).Notify(ctx, notice), "not make a valid email address")
+}
+
+func TestNotificationConfiguration(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupIn(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, config.NotifierLog, cfg.Notifications.Notifier)
+	assert.Equal(t, "localhost:1025", cfg.Notifications.SMTPAddr)
+	assert.Equal(t, 10*time.Second, cfg.Notifications.Timeout)
+	assert.IsType(t, notify.Log{}, notify.New(cfg.Notifications))
+
+	cfg, err = config.LoadFrom(lookupIn(map[string]string{
+		"WORKSHOP_NOTIFIER":              "SMTP",
+		"WORKSHOP_SMTP_ADDR":             "mail.example.com:587",
+		"WORKSHOP_SMTP_FROM":             "Workshops <workshops@example.com>",
+		"WORKSHOP_SMTP_USERNAME":         "mailer",
+		"WORKSHOP_SMTP_PASSWORD":         "mail-password",
+		"WORKSHOP_SMTP_RECIPIENT_DOMAIN": "example.com",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, config.NotifierSMTP, cfg.Notifications.Notifier)
+	assert.IsType(t, &notify.SMTP{}, notify.New(cfg.Notifications))
+
+	_, err = config.LoadFrom(lookupIn(map[string]string{
+		"WORKSHOP_NOTIFIER":              "smtp",
+		"WORKSHOP_SMTP_ADDR":             "localhost",
+		"WORKSHOP_SMTP_FROM":             "nobody",
+		"WORKSHOP_SMTP_USERNAME":         "mailer",
+		"WORKSHOP_SMTP_RECIPIENT_DOMAIN": "@example.com",
+	}))
+	assert.ErrorContains(t, err, "WORKSHOP_SMTP_ADDR")
+	assert.ErrorContains(t, err, "WORKSHOP_SMTP_FROM")
+	assert.ErrorContains(t, err, "WORKSHOP_SMTP_USERNAME and WORKSHOP_SMTP_PASSWORD must be set together")
+	assert.ErrorContains(t, err, "WORKSHOP_SMTP_RECIPIENT_DOMAIN")
+
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_NOTIFIER": "webhook", "WORKSHOP_NOTIFY_WEBHOOK_URL": "ftp://hooks.example.com/?token=hook-token"}))
+	assert.ErrorContains(t, err, "WORKSHOP_NOTIFY_WEBHOOK_URL must be an http or https URL")
+	assert.NotContains(t, err.Error(), "hook-token")
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_NOTIFIER": "pigeon"}))
+	assert.ErrorContains(t, err, "WORKSHOP_NOTIFIER must be log, smtp or webhook")
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_NOTIFY_TIMEOUT": "0s"}))
+	assert.ErrorContains(t, err, "WORKSHOP_NOTIFY_TIMEOUT must be positive")
+}
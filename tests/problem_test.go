@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"testing"
+
+	"workshop/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorsAreProblemDetails(t *testing.T) {
+	res, body := sendRequest(http.MethodGet, testServer.URL+"/workshop/nobody/2023-01-01T00:00:00.000Z", nil, http.Header{"X-Request-Id": {"trace-123"}})
+	assert.Equal(t, 404, res.StatusCode)
+	assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+	assert.Equal(t, "trace-123", res.Header.Get("X-Request-Id"))
+	assert.Equal(t, "workshop_not_found", body["code"])
+	assert.Equal(t, float64(404), body["status"])
+	assert.Equal(t, "Not Found", body["title"])
+	assert.Equal(t, "Workshop not found.", body["detail"])
+	assert.Equal(t, "/workshop/nobody/2023-01-01T00:00:00.000Z", body["instance"])
+	assert.Equal(t, "urn:greenharbor:workshop:problem:workshop_not_found", body["type"])
+	assert.Equal(t, "trace-123", body["request_id"])
+	// kept for clients that still read message
+	assert.Equal(t, "Workshop not found.", body["message"])
+
+	// field level details, and a request ID of our own when none is sent
+	res, body = sendPatch(testServer.URL+"/workshop/1/2023-11-04-03:28:10.244", map[string]interface{}{"Title": "", "Vacancies": -1})
+	assert.Equal(t, 400, res.StatusCode)
+	assert.Equal(t, "validation_failed", body["code"])
+	assert.Contains(t, body["fields"], "Title")
+	assert.Contains(t, body["fields"], "Vacancies")
+	assert.NotEmpty(t, body["request_id"])
+	assert.Equal(t, res.Header.Get("X-Request-Id"), body["request_id"])
+
+	res, body = sendRequest(http.MethodGet, testServer.URL+"/workshop?limit=0", nil, nil)
+	assert.Equal(t, 400, res.StatusCode)
+	assert.Contains(t, body["fields"], "limit")
+
+	res, body = sendRequest(http.MethodGet, testServer.URL+"/nowhere/at/all/really", nil, nil)
+	assert.Equal(t, 404, res.StatusCode)
+	assert.Equal(t, "route_not_found", body["code"])
+	assert.NotEmpty(t, res.Header.Get("X-Request-Id"))
+
+	res, body = sendRequest(http.MethodPut, testServer.URL+"/workshop", nil, nil)
+	assert.Equal(t, 405, res.StatusCode)
+	assert.Equal(t, "method_not_allowed", body["code"])
+}
+
+func TestRegistrationErrorCodes(t *testing.T) {
+	workshop := models.Workshop{
+		Creator_Id:            "codes",
+		Creation_Timestamp:    "2023-11-22T10:00:00.000Z",
+		Vacancies:             1,
+		Attendees:             []string{},
+		Registration_Deadline: "2099-02-08T23:59:59.000Z",
+		Start_Timestamp:       "2099-02-15T15:00:00.000Z",
+	}
+	if err := testStore.Put(context.Background(), workshop); err != nil {
+		log.Fatalf("Failed to seed the workshop in TestRegistrationErrorCodes: %v", err)
+	}
+	url := testServer.URL + "/workshop/register/codes/2023-11-22T10:00:00.000Z"
+
+	res, _ := sendPatch(url, map[string]interface{}{"User_Id": "c1"})
+	assert.Equal(t, 200, res.StatusCode)
+	res, body := sendPatch(url, map[string]interface{}{"User_Id": "c1"})
+	assert.Equal(t, 400, res.StatusCode)
+	assert.Equal(t, "already_registered", body["code"])
+
+	// a full workshop only waitlists those who are willing
+	res, body = sendPatch(url+"?waitlist=false", map[string]interface{}{"User_Id": "c2"})
+	assert.Equal(t, 409, res.StatusCode)
+	assert.Equal(t, "workshop_full", body["code"])
+	res, _ = sendPatch(url, map[string]interface{}{"User_Id": "c2"})
+	assert.Equal(t, 202, res.StatusCode)
+
+	res, body = sendPatch(testServer.URL+"/workshop/withdraw/codes/2023-11-22T10:00:00.000Z", map[string]interface{}{"User_Id": "c3"})
+	assert.Equal(t, 400, res.StatusCode)
+	assert.Equal(t, "not_registered", body["code"])
+
+	res, body = sendPatch(url, map[string]interface{}{"User_Id": 7})
+	assert.Equal(t, 400, res.StatusCode)
+	assert.Contains(t, body["fields"], "User_Id")
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"workshop/config"
+	"workshop/metrics"
+	"workshop/ratelimit"
+	"workshop/routes"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowly refills so slowly that no test sees a token come back.
+const slowly = 0.001
+
+func TestRegistrationIsRateLimited(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{Limits: ratelimit.New(config.RateLimits{
+		Reads:        config.Limit{Rate: slowly, Burst: 1},
+		Registration: config.Limit{Rate: slowly, Burst: 2},
+	})})
+	url := seedAuthWorkshop(t, "limited-host") + "/register"
+	limited := testutil.ToFloat64(metrics.RateLimited.WithLabelValues(ratelimit.GroupRegistration))
+
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url, `{"User_Id": "grabber1"}`, from("192.0.2.1:5000")).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url, `{"User_Id": "grabber2"}`, from("192.0.2.1:5001")).Code)
+	rec := serveRequest(handler, http.MethodPatch, url, `{"User_Id": "grabber3"}`, from("192.0.2.1:5002"))
+	assert.Equal(t, 429, rec.Code)
+	assert.Equal(t, "rate_limited", problemCode(t, rec))
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.Greater(t, retryAfter, 500)
+	assert.Equal(t, limited+1, testutil.ToFloat64(metrics.RateLimited.WithLabelValues(ratelimit.GroupRegistration)))
+
+	// the other groups, and other clients, have buckets of their own
+	assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/workshop", "", from("192.0.2.1:5003")).Code)
+	assert.Equal(t, 429, serveRequest(handler, http.MethodGet, "/workshop", "", from("192.0.2.1:5003")).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, url, `{"User_Id": "grabber3"}`, from("192.0.2.2:5000")).Code)
+	// writes are not limited here, and probes never are
+	assert.Equal(t, 200, serveRequest(handler, http.MethodPatch, strings.TrimSuffix(url, "/register"), `{"Title": "Still open"}`, from("192.0.2.1:5004")).Code)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/health", "", from("192.0.2.1:5005")).Code)
+	}
+}
+
+func TestRateLimitsFollowTheUser(t *testing.T) {
+	authenticator := newAuthenticator(t, hs256Auth)
+	handler := newHandler(testStore, routes.Options{Authenticator: authenticator, Limits: ratelimit.New(config.RateLimits{Reads: config.Limit{Rate: slowly, Burst: 1}})})
+	bearer := func(subject string) requestOption {
+		return withToken(token(t, subject))
+	}
+
+	// users behind one address are limited apart
+	assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/users/frank/registrations", "", from("198.51.100.1:5000"), bearer("frank")).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/users/grace/registrations", "", from("198.51.100.1:5000"), bearer("grace")).Code)
+	// and a user cannot get more by moving to another
+	assert.Equal(t, 429, serveRequest(handler, http.MethodGet, "/users/frank/registrations", "", from("198.51.100.2:5000"), bearer("frank")).Code)
+	// anonymous callers go by their address
+	assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/workshop", "", from("198.51.100.1:5000")).Code)
+	assert.Equal(t, 429, serveRequest(handler, http.MethodGet, "/workshop", "", from("198.51.100.1:5001")).Code)
+}
+
+func TestRateLimitsLookPastTrustedProxies(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{Limits: ratelimit.New(config.RateLimits{Reads: config.Limit{Rate: slowly, Burst: 1}, ProxyHops: 1})})
+	proxy := "10.0.0.1:5000"
+	forwarded := func(chain string) requestOption {
+		return withHeader("X-Forwarded-For", chain)
+	}
+
+	assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/workshop", "", from(proxy), forwarded("203.0.113.5")).Code)
+	// whatever the client adds in front of what the proxy saw is ignored
+	assert.Equal(t, 429, serveRequest(handler, http.MethodGet, "/workshop", "", from(proxy), forwarded("192.0.2.77, 203.0.113.5")).Code)
+	assert.Equal(t, 200, serveRequest(handler, http.MethodGet, "/workshop", "", from(proxy), forwarded("203.0.113.6")).Code)
+}
+
+func TestRateLimitConfiguration(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupIn(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, config.Limit{Rate: 0.5, Burst: 5}, cfg.RateLimits.Registration)
+	assert.Equal(t, 0, cfg.RateLimits.ProxyHops)
+
+	cfg, err = config.LoadFrom(lookupIn(map[string]string{
+		"WORKSHOP_RATE_LIMIT_WRITES":       "0",
+		"WORKSHOP_RATE_LIMIT_WRITES_BURST": "0",
+		"WORKSHOP_RATE_LIMIT_READS":        "100",
+		"WORKSHOP_RATE_LIMIT_READS_BURST":  "200",
+		"WORKSHOP_TRUSTED_PROXY_HOPS":      "2",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, config.Limit{Rate: 100, Burst: 200}, cfg.RateLimits.Reads)
+	assert.Equal(t, 2, cfg.RateLimits.ProxyHops)
+
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_RATE_LIMIT_REGISTRATION": "-1"}))
+	assert.ErrorContains(t, err, "WORKSHOP_RATE_LIMIT_REGISTRATION may not be negative")
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_RATE_LIMIT_READS_BURST": "0"}))
+	assert.ErrorContains(t, err, "WORKSHOP_RATE_LIMIT_READS_BURST must be at least 1")
+	_, err = config.LoadFrom(lookupIn(map[string]string{"WORKSHOP_TRUSTED_PROXY_HOPS": "-1"}))
+	assert.ErrorContains(t, err, "WORKSHOP_TRUSTED_PROXY_HOPS")
+}
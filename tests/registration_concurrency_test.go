@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"testing"
+
+	"workshop/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConcurrentRegistrations fires far more registrations than there are
+// seats and checks that no seat is handed out twice and no attendee or
+// waitlisted user is lost.
+func TestConcurrentRegistrations(t *testing.T) {
+	const vacancies = 20
+	const registrations = 300
+
+	workshop := models.Workshop{
+		Creator_Id:            "concurrency",
+		Creation_Timestamp:    "2023-11-05-10:00:00.000",
+		Title:                 "Crowded workshop",
+		Vacancies:             vacancies,
+		Attendees:             []string{},
+		Registration_Deadline: "2099-02-08-23:59:59.000",
+		Start_Timestamp:       "2099-02-15-15:00:00.000",
+	}
+	if err := testStore.Put(context.Background(), workshop); err != nil {
+		log.Fatalf("Failed to seed the workshop in TestConcurrentRegistrations: %v", err)
+	}
+	url := testServer.URL + "/workshop/register/concurrency/2023-11-05-10:00:00.000"
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	statusCodes := map[int]int{}
+	for i := 0; i < registrations; i++ {
+		wg.Add(1)
+		go func(userID string) {
+			defer wg.Done()
+			res, _ := sendPatch(url, map[string]interface{}{"User_Id": userID})
+			mu.Lock()
+			statusCodes[res.StatusCode]++
+			mu.Unlock()
+		}(fmt.Sprintf("user-%d", i))
+	}
+	wg.Wait()
+
+	// every request either got a seat, a place on the waitlist or a clear conflict
+	assert.Equal(t, registrations, statusCodes[http.StatusOK]+statusCodes[http.StatusAccepted]+statusCodes[http.StatusConflict], "Unexpected status codes: %v", statusCodes)
+
+	result, err := testStore.Get(context.Background(), workshop.Creator_Id, workshop.Creation_Timestamp)
+	if err != nil {
+		log.Fatalf("Failed to read back the workshop in TestConcurrentRegistrations: %v", err)
+	}
+	assert.Equal(t, statusCodes[http.StatusOK], len(result.Attendees))
+	assert.Equal(t, statusCodes[http.StatusAccepted], len(result.Waitlist))
+	assert.Equal(t, int64(vacancies), result.Vacancies+int64(len(result.Attendees)))
+	assert.True(t, result.Vacancies >= 0, "Vacancies dropped below zero: %d", result.Vacancies)
+	if len(result.Waitlist) > 0 {
+		assert.Equal(t, int64(0), result.Vacancies, "Users were waitlisted while seats were free")
+	}
+
+	seen := map[string]bool{}
+	for _, user := range append(result.Attendees, result.Waitlist...) {
+		assert.False(t, seen[user], "User %s registered twice", user)
+		seen[user] = true
+	}
+}
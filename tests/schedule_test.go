@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"testing"
+
+	"workshop/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRejectsInvalidSchedule(t *testing.T) {
+	schedules := map[string][2]string{
+		"deadline after start": {"2099-02-11-00:00:00.000", "2099-02-10-15:00:00.000"},
+		"start in the past":    {"2020-02-09-23:59:59.000", "2020-02-10-15:00:00.000"},
+		"unparsable deadline":  {"next tuesday", "2099-02-10-15:00:00.000"},
+		"missing start":        {"2099-02-09-23:59:59.000", ""},
+	}
+	for name, schedule := range schedules {
+		requestBody := map[string]interface{}{
+			"Creator_Id":            "schedule",
+			"Title":                 "Badly scheduled workshop",
+			"Vacancies":             5,
+			"Registration_Deadline": schedule[0],
+			"Start_Timestamp":       schedule[1],
+		}
+		jsonData, err := json.Marshal(requestBody)
+		if err != nil {
+			log.Fatalf("Failed to marshal requestBody JSON in TestCreateRejectsInvalidSchedule: %v", err)
+		}
+		res, err := http.Post(testServer.URL+"/workshop", "application/json", bytes.NewBuffer(jsonData))
+		if err != nil {
+			log.Fatalf("Failed to send the HTTP request: %v", err)
+		}
+		res.Body.Close()
+		assert.Equal(t, 400, res.StatusCode, "Expected %s to be rejected", name)
+	}
+}
+
+func TestPatchRejectsInvalidSchedule(t *testing.T) {
+	url := testServer.URL + "/workshop/1/2023-11-04-03:28:10.244"
+
+	res, _ := sendPatch(url, map[string]interface{}{"Registration_Deadline": "2099-03-01-00:00:00.000"})
+	assert.Equal(t, 400, res.StatusCode, "Expected result to be %d, but got %d", 400, res.StatusCode)
+
+	result, err := testStore.Get(context.Background(), "1", "2023-11-04-03:28:10.244")
+	if err != nil {
+		log.Fatalf("Failed to read back the workshop in TestPatchRejectsInvalidSchedule: %v", err)
+	}
+	assert.Equal(t, testDBSeedData[1].Registration_Deadline, result.Registration_Deadline)
+}
+
+func TestRegistrationWindow(t *testing.T) {
+	closed := models.Workshop{
+		Creator_Id:            "schedule",
+		Creation_Timestamp:    "2023-11-07-10:00:00.000",
+		Vacancies:             5,
+		Attendees:             []string{},
+		Registration_Deadline: "2023-12-01-23:59:59.000",
+		Start_Timestamp:       "2099-02-15-15:00:00.000",
+	}
+	started := models.Workshop{
+		Creator_Id:            "schedule",
+		Creation_Timestamp:    "2023-11-08-10:00:00.000",
+		Vacancies:             5,
+		Attendees:             []string{"early-bird"},
+		Registration_Deadline: "2023-12-01-23:59:59.000",
+		Start_Timestamp:       "2023-12-02-15:00:00.000",
+	}
+	for _, workshop := range []models.Workshop{closed, started} {
+		if err := testStore.Put(context.Background(), workshop); err != nil {
+			log.Fatalf("Failed to seed the workshop in TestRegistrationWindow: %v", err)
+		}
+	}
+
+	res, body := sendPatch(testServer.URL+"/workshop/register/schedule/2023-11-07-10:00:00.000", map[string]interface{}{"User_Id": "late"})
+	assert.Equal(t, 403, res.StatusCode)
+	assert.Equal(t, "Registration for this workshop has closed.", body["message"])
+
+	res, body = sendPatch(testServer.URL+"/workshop/register/schedule/2023-11-08-10:00:00.000", map[string]interface{}{"User_Id": "late"})
+	assert.Equal(t, 409, res.StatusCode)
+	assert.Equal(t, "Workshop has already started.", body["message"])
+
+	res, body = sendPatch(testServer.URL+"/workshop/withdraw/schedule/2023-11-08-10:00:00.000", map[string]interface{}{"User_Id": "early-bird"})
+	assert.Equal(t, 409, res.StatusCode)
+	assert.Equal(t, "Workshop has already started.", body["message"])
+}
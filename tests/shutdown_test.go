@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"workshop/models"
+	"workshop/routes"
+	"workshop/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingStore holds every Get until it is released or the request behind
+// it is cancelled.
+type blockingStore struct {
+	store.WorkshopStore
+	started  chan struct{}
+	release  chan struct{}
+	finished chan error
+}
+
+func newBlockingStore() *blockingStore {
+	return &blockingStore{
+		WorkshopStore: testStore,
+		started:       make(chan struct{}, 1),
+		release:       make(chan struct{}),
+		finished:      make(chan error, 1),
+	}
+}
+
+func (s *blockingStore) Get(ctx context.Context, creatorID string, creationTimestamp string) (models.Workshop, error) {
+	s.started <- struct{}{}
+	select {
+	case <-s.release:
+		s.finished <- nil
+		return s.WorkshopStore.Get(ctx, creatorID, creationTimestamp)
+	case <-ctx.Done():
+		s.finished <- ctx.Err()
+		return models.Workshop{}, ctx.Err()
+	}
+}
+
+// serve runs the service on a port of its own until ctx is done.
+func serve(ctx context.Context, workshops store.WorkshopStore, drain time.Duration) (string, chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- routes.Serve(ctx, &http.Server{Handler: newHandler(workshops, routes.Options{})}, l, drain)
+	}()
+	return "http://" + l.Addr().String(), stopped
+}
+
+func TestShutdownDrainsRequestsInFlight(t *testing.T) {
+	blocking := newBlockingStore()
+	ctx, shutDown := context.WithCancel(context.Background())
+	url, stopped := serve(ctx, blocking, 5*time.Second)
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		res, _ := sendRequest(http.MethodGet, url+"/workshop/2/2023-10-20-21:22:22.080", nil, nil)
+		responses <- res
+	}()
+	<-blocking.started
+	shutDown()
+
+	// no new connections once shutdown has begun
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	close(blocking.release)
+	res := <-responses
+	if assert.NotNil(t, res) {
+		assert.Equal(t, 200, res.StatusCode)
+	}
+	assert.NoError(t, <-stopped)
+}
+
+func TestShutdownCutsOffRequestsAfterTheDeadline(t *testing.T) {
+	blocking := newBlockingStore()
+	ctx, shutDown := context.WithCancel(context.Background())
+	url, stopped := serve(ctx, blocking, 50*time.Millisecond)
+
+	// the connection is dropped, so the client only sees an error
+	go http.Get(url + "/workshop/2/2023-10-20-21:22:22.080")
+	<-blocking.started
+	shutDown()
+
+	assert.ErrorIs(t, <-stopped, context.DeadlineExceeded)
+	// the store call stops waiting instead of outliving the server
+	select {
+	case err := <-blocking.finished:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Error("Expected the store call to be cancelled")
+	}
+}
+
+func TestCancelledRequestsStopHittingTheStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := testStore.Get(ctx, "2", "2023-10-20-21:22:22.080")
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// a registration whose client already gave up is not made
+	req := httptest.NewRequest(http.MethodPatch, "/workshop/register/2/2023-10-20-21:22:22.080", strings.NewReader(`{"User_Id": "gave-up"}`)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	newHandler(testStore, routes.Options{}).ServeHTTP(rec, req)
+	assert.Equal(t, 503, rec.Code)
+	assert.Contains(t, rec.Body.String(), "request_canceled")
+
+	workshop, err := testStore.Get(context.Background(), "2", "2023-10-20-21:22:22.080")
+	assert.NoError(t, err)
+	assert.NotContains(t, workshop.Attendees, "gave-up")
+	assert.NotContains(t, workshop.Waitlist, "gave-up")
+}
@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"workshop/models"
+	"workshop/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeZones(t *testing.T) {
+	res, body := sendRequest(http.MethodPost, testServer.URL+"/workshop", map[string]interface{}{
+		"Creator_Id":            "zones",
+		"Title":                 "Tea in London",
+		"Vacancies":             5,
+		"Time_Zone":             "Europe/London",
+		"Registration_Deadline": "2099-06-30T12:00:00Z",
+		"Start_Timestamp":       "2099-07-01T10:00:00",
+	}, nil)
+	assert.Equal(t, 201, res.StatusCode)
+	assert.True(t, strings.HasSuffix(body["Creation_Timestamp"].(string), "Z"))
+	url := testServer.URL + "/workshop/id/" + body["Workshop_Id"].(string)
+
+	// times without an offset are read in the workshop's zone and stored in UTC
+	res, body = sendRequest(http.MethodGet, url, nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "2099-07-01T09:00:00.000Z", body["Start_Timestamp"])
+	assert.Equal(t, "2099-06-30T12:00:00.000Z", body["Registration_Deadline"])
+	assert.Equal(t, "Europe/London", body["Time_Zone"])
+
+	_, body = sendRequest(http.MethodGet, url+"?tz=workshop", nil, nil)
+	assert.Equal(t, "2099-07-01T10:00:00.000+01:00", body["Start_Timestamp"])
+	_, body = sendRequest(http.MethodGet, url+"?tz=Asia/Singapore", nil, nil)
+	assert.Equal(t, "2099-07-01T17:00:00.000+08:00", body["Start_Timestamp"])
+	res, _ = sendRequest(http.MethodGet, url+"?tz=Mars/Olympus_Mons", nil, nil)
+	assert.Equal(t, 400, res.StatusCode)
+
+	// moving the workshop keeps its stored times, but later local times are
+	// read in the new zone
+	res, _ = sendPatch(url, map[string]interface{}{"Time_Zone": "Asia/Tokyo", "Start_Timestamp": "2099-07-01T10:00:00"})
+	assert.Equal(t, 200, res.StatusCode)
+	_, body = sendRequest(http.MethodGet, url, nil, nil)
+	assert.Equal(t, "2099-07-01T01:00:00.000Z", body["Start_Timestamp"])
+	assert.Equal(t, "2099-06-30T12:00:00.000Z", body["Registration_Deadline"])
+
+	res, body = sendPatch(url, map[string]interface{}{"Time_Zone": "Nowhere/Special"})
+	assert.Equal(t, 400, res.StatusCode)
+	assert.Contains(t, body["fields"], "Time_Zone")
+
+	res, _ = sendRequest(http.MethodPost, testServer.URL+"/workshop", map[string]interface{}{
+		"Creator_Id":            "zones",
+		"Title":                 "Nowhere in particular",
+		"Vacancies":             5,
+		"Time_Zone":             "Nowhere/Special",
+		"Registration_Deadline": "2099-06-30T12:00:00Z",
+		"Start_Timestamp":       "2099-07-01T10:00:00Z",
+	}, nil)
+	assert.Equal(t, 400, res.StatusCode)
+}
+
+func TestMigrateLegacyTimestamps(t *testing.T) {
+	legacy := models.Workshop{
+		Creator_Id:            "legacy",
+		Creation_Timestamp:    "2023-11-20-08:00:00.000",
+		Title:                 "Stored in Singapore time",
+		Vacancies:             0,
+		Attendees:             []string{"l1"},
+		Waitlist:              []string{"l2"},
+		Registration_Deadline: "2099-02-08-23:59:59.000",
+		Start_Timestamp:       "2099-02-15-15:00:00.000",
+	}
+	current := models.Workshop{
+		Workshop_Id:           "current",
+		Creator_Id:            "legacy",
+		Creation_Timestamp:    "2023-11-21T00:00:00.000Z",
+		Time_Zone:             "UTC",
+		Registration_Deadline: "2099-02-08T00:00:00.000Z",
+		Start_Timestamp:       "2099-02-15T00:00:00.000Z",
+	}
+	workshops := store.NewMemoryStore(legacy, current)
+	outbox := workshops.Outbox()
+
+	count, err := store.MigrateLegacyTimestamps(context.Background(), workshops)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = workshops.Get(context.Background(), "legacy", "2023-11-20-08:00:00.000")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	result, err := workshops.Get(context.Background(), "legacy", "2023-11-20T00:00:00.000Z")
+	assert.NoError(t, err)
+	assert.Equal(t, "2099-02-08T15:59:59.000Z", result.Registration_Deadline)
+	assert.Equal(t, "2099-02-15T07:00:00.000Z", result.Start_Timestamp)
+	assert.Equal(t, models.LegacyTimeZone, result.Time_Zone)
+	assert.NotEmpty(t, result.Workshop_Id)
+	byID, err := workshops.GetByID(context.Background(), result.Workshop_Id)
+	assert.NoError(t, err)
+	assert.Equal(t, result.Creation_Timestamp, byID.Creation_Timestamp)
+
+	// registration records follow the workshop to its new key
+	for _, userID := range []string{"l1", "l2"} {
+		registrations, err := workshops.ListRegistrations(context.Background(), userID)
+		assert.NoError(t, err)
+		if assert.Len(t, registrations, 1) {
+			assert.Equal(t, "2023-11-20T00:00:00.000Z", registrations[0].Creation_Timestamp)
+			assert.Equal(t, result.Workshop_Id, registrations[0].Workshop_Id)
+		}
+	}
+
+	// a run that stopped before deleting the legacy item picks up where it left off
+	assert.NoError(t, workshops.Put(context.Background(), legacy))
+	count, err = store.MigrateLegacyTimestamps(context.Background(), workshops)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	_, err = workshops.Get(context.Background(), "legacy", "2023-11-20-08:00:00.000")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	page, err := workshops.ListByCreator(context.Background(), "legacy", store.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, page.Workshops, 2)
+
+	count, err = store.MigrateLegacyTimestamps(context.Background(), workshops)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// moving workshops to their new keys changes nothing worth announcing
+	pending, err := outbox.Pending(context.Background(), 100)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestMigrateLegacyTimestampsNamesTheWorkshopThatCollides(t *testing.T) {
+	legacy := models.Workshop{
+		Creator_Id:            "collider",
+		Creation_Timestamp:    "2023-11-20-08:00:00.000",
+		Registration_Deadline: "2099-02-08-23:59:59.000",
+		Start_Timestamp:       "2099-02-15-15:00:00.000",
+	}
+	taken := models.Workshop{
+		Workshop_Id:           "taken",
+		Creator_Id:            "collider",
+		Creation_Timestamp:    "2023-11-20T00:00:00.000Z",
+		Registration_Deadline: "2099-02-08T00:00:00.000Z",
+		Start_Timestamp:       "2099-02-15T00:00:00.000Z",
+	}
+	workshops := store.NewMemoryStore(legacy, taken)
+
+	count, err := store.MigrateLegacyTimestamps(context.Background(), workshops)
+	assert.ErrorIs(t, err, store.ErrAlreadyExists)
+	assert.Equal(t, 0, count)
+	// legacy items have no Workshop_Id of their own, so the error names the
+	// one they were given and their key
+	assert.Contains(t, err.Error(), "Creator_Id collider, Creation_Timestamp 2023-11-20-08:00:00.000")
+	assert.NotContains(t, err.Error(), "workshop  (")
+	_, err = workshops.Get(context.Background(), "collider", "2023-11-20-08:00:00.000")
+	assert.NoError(t, err)
+}
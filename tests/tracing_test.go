@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"workshop/config"
+	"workshop/models"
+	"workshop/routes"
+	"workshop/store"
+	"workshop/tracing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans sends every span to an in-memory exporter for the rest of the
+// test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	tracing.Install(tracing.NewProvider(sdktrace.WithSyncer(exporter), 1))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func spanNamed(spans tracetest.SpanStubs, name string) (tracetest.SpanStub, bool) {
+	for _, span := range spans {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return tracetest.SpanStub{}, false
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestRequestsAreTraced(t *testing.T) {
+	exporter := recordSpans(t)
+	logged := captureLog(t)
+	workshop := models.Workshop{
+		Creator_Id:            "traced",
+		Creation_Timestamp:    "2023-11-24T10:00:00.000Z",
+		Vacancies:             1,
+		Attendees:             []string{},
+		Registration_Deadline: "2099-02-08T23:59:59.000Z",
+		Start_Timestamp:       "2099-02-15T15:00:00.000Z",
+	}
+	if err := testStore.Put(context.Background(), workshop); err != nil {
+		t.Fatalf("Failed to seed the workshop in TestRequestsAreTraced: %v", err)
+	}
+	handler := newHandler(store.NewTracedStore(testStore), routes.Options{})
+
+	// the caller's trace carries on in ours
+	req := httptest.NewRequest(http.MethodPatch, "/workshop/register/traced/2023-11-24T10:00:00.000Z", strings.NewReader(`{"User_Id": "t1"}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, 200, rec.Code)
+
+	spans := exporter.GetSpans()
+	server, ok := spanNamed(spans, "PATCH /workshop/register/{creator_id}/{creation_timestamp}")
+	if !assert.True(t, ok, "Expected a span for the route") {
+		return
+	}
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.True(t, server.Parent.IsRemote())
+	assert.Equal(t, int64(200), spanAttribute(server, "http.status_code").AsInt64())
+	assert.Equal(t, "/workshop/register/{creator_id}/{creation_timestamp}", spanAttribute(server, "http.route").AsString())
+	// log lines of the request can be found from the trace
+	assert.Contains(t, logged.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+
+	register, ok := spanNamed(spans, "store.Register")
+	if assert.True(t, ok, "Expected a span for the store operation") {
+		assert.Equal(t, server.SpanContext.SpanID(), register.Parent.SpanID())
+		assert.False(t, spanAttribute(register, "workshop.waitlisted").AsBool())
+		for _, kv := range register.Attributes {
+			assert.NotEqual(t, "t1", kv.Value.Emit())
+			assert.NotEqual(t, "traced", kv.Value.Emit())
+		}
+	}
+
+	// expected domain errors do not mark the spans as failed
+	exporter.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/workshop/id/no-such-workshop", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	getByID, ok := spanNamed(exporter.GetSpans(), "store.GetByID")
+	if assert.True(t, ok) {
+		assert.Equal(t, codes.Unset, getByID.Status.Code)
+		assert.Equal(t, "workshop_not_found", spanAttribute(getByID, "workshop.error_code").AsString())
+	}
+}
+
+func TestFailedRequestsAreMarked(t *testing.T) {
+	exporter := recordSpans(t)
+	captureLog(t)
+	newHandler(panickingStore{testStore}, routes.Options{}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/workshop", nil))
+
+	server, ok := spanNamed(exporter.GetSpans(), "GET /workshop")
+	if assert.True(t, ok) {
+		assert.Equal(t, codes.Error, server.Status.Code)
+		assert.Equal(t, int64(500), spanAttribute(server, "http.status_code").AsInt64())
+	}
+}
+
+func TestDynamoDBCallsAreTraced(t *testing.T) {
+	exporter := recordSpans(t)
+	// nothing listens on this port, so every call fails without retrying
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("ap-southeast-1"),
+		Endpoint:    aws.String("http://127.0.0.1:1"),
+		Credentials: awscredentials.NewStaticCredentials("AKIATRACING", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	unreachable := store.NewTracedStore(store.NewDynamoStore(dynamodb.New(sess), store.DynamoTables{Workshops: "workshop", Registrations: "workshop_registrations"}))
+
+	_, err := unreachable.Get(context.Background(), "1", "2023-11-04-03:28:10.244")
+	assert.Error(t, err)
+
+	spans := exporter.GetSpans()
+	getItem, ok := spanNamed(spans, "DynamoDB.GetItem")
+	if !assert.True(t, ok, "Expected a span for the DynamoDB call") {
+		return
+	}
+	assert.Equal(t, trace.SpanKindClient, getItem.SpanKind)
+	assert.Equal(t, codes.Error, getItem.Status.Code)
+	assert.Equal(t, "RequestError", getItem.Status.Description)
+	assert.Equal(t, "dynamodb", spanAttribute(getItem, "db.system").AsString())
+	assert.Equal(t, []string{"workshop"}, spanAttribute(getItem, "aws.dynamodb.table_names").AsStringSlice())
+
+	get, ok := spanNamed(spans, "store.Get")
+	if assert.True(t, ok) {
+		assert.Equal(t, get.SpanContext.SpanID(), getItem.Parent.SpanID())
+		assert.Equal(t, codes.Error, get.Status.Code)
+	}
+}
+
+func TestTracingConfiguration(t *testing.T) {
+	cfg, err := config.LoadFrom(lookupIn(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, config.TracesNone, cfg.Tracing.Exporter)
+	assert.Equal(t, float64(1), cfg.Tracing.SampleRatio)
+
+	cfg, err = config.LoadFrom(lookupIn(map[string]string{
+		"WORKSHOP_TRACES_EXPORTER":     "OTLP",
+		"WORKSHOP_OTLP_ENDPOINT":       "http://collector:4318",
+		"WORKSHOP_TRACES_SAMPLE_RATIO": "0.25",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, config.TracesOTLP, cfg.Tracing.Exporter)
+	assert.Equal(t, 0.25, cfg.Tracing.SampleRatio)
+
+	_, err = config.LoadFrom(lookupIn(map[string]string{
+		"WORKSHOP_TRACES_EXPORTER":     "zipkin",
+		"WORKSHOP_OTLP_ENDPOINT":       "collector",
+		"WORKSHOP_TRACES_SAMPLE_RATIO": "2",
+	}))
+	assert.ErrorContains(t, err, "WORKSHOP_TRACES_EXPORTER")
+	assert.ErrorContains(t, err, "WORKSHOP_TRACES_SAMPLE_RATIO")
+
+	// a stdout exporter can be set up and shut down again
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+	shutdown, err := tracing.Setup(context.Background(), config.Config{Tracing: config.Tracing{Exporter: config.TracesStdout, SampleRatio: 1}})
+	if assert.NoError(t, err) {
+		assert.NoError(t, shutdown(context.Background()))
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"testing"
+
+	"workshop/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getUserRegistrations(path string) (int, []models.Registration) {
+	res, err := http.Get(testServer.URL + path)
+	if err != nil {
+		log.Fatalf("Failed to send the HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+	var registrations []models.Registration
+	if res.StatusCode == 200 {
+		if err := json.NewDecoder(res.Body).Decode(&registrations); err != nil {
+			log.Fatalf("Failed to decode the response body: %v", err)
+		}
+	}
+	return res.StatusCode, registrations
+}
+
+func TestUserRegistrations(t *testing.T) {
+	workshop := models.Workshop{
+		Creator_Id:            "registrations",
+		Creation_Timestamp:    "2023-11-10-10:00:00.000",
+		Title:                 "Seed swapping",
+		Vacancies:             1,
+		Attendees:             []string{},
+		Registration_Deadline: "2099-02-08-23:59:59.000",
+		Start_Timestamp:       "2099-02-15-15:00:00.000",
+	}
+	if err := testStore.Put(context.Background(), workshop); err != nil {
+		log.Fatalf("Failed to seed the workshop in TestUserRegistrations: %v", err)
+	}
+	registerURL := testServer.URL + "/workshop/register/registrations/2023-11-10-10:00:00.000"
+	sendPatch(registerURL, map[string]interface{}{"User_Id": "reg-a"})
+	sendPatch(registerURL, map[string]interface{}{"User_Id": "reg-b"})
+
+	_, registrations := getUserRegistrations("/users/reg-a/registrations")
+	if assert.Len(t, registrations, 1) {
+		assert.Equal(t, "registrations", registrations[0].Creator_Id)
+		assert.Equal(t, "2023-11-10-10:00:00.000", registrations[0].Creation_Timestamp)
+		assert.Equal(t, models.RegistrationStatusRegistered, registrations[0].Status)
+	}
+	_, registrations = getUserRegistrations("/users/reg-b/registrations?status=waitlisted")
+	assert.Len(t, registrations, 1)
+	_, registrations = getUserRegistrations("/users/reg-b/registrations?status=registered")
+	assert.Len(t, registrations, 0)
+
+	// withdrawing hands reg-a's seat to reg-b
+	sendPatch(testServer.URL+"/workshop/withdraw/registrations/2023-11-10-10:00:00.000", map[string]interface{}{"User_Id": "reg-a"})
+	_, registrations = getUserRegistrations("/users/reg-a/registrations")
+	assert.Len(t, registrations, 0)
+	_, registrations = getUserRegistrations("/users/reg-b/registrations")
+	if assert.Len(t, registrations, 1) {
+		assert.Equal(t, models.RegistrationStatusRegistered, registrations[0].Status)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, testServer.URL+"/workshop/registrations/2023-11-10-10:00:00.000", nil)
+	if err != nil {
+		log.Fatalf("Failed to build the DELETE request: %v", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("Failed to send the HTTP request: %v", err)
+	}
+	res.Body.Close()
+	_, registrations = getUserRegistrations("/users/reg-b/registrations")
+	assert.Len(t, registrations, 0)
+
+	status, _ := getUserRegistrations("/users/reg-b/registrations?status=cancelled")
+	assert.Equal(t, 400, status)
+}
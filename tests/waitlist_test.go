@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"testing"
+
+	"workshop/models"
+	"workshop/routes"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getWaitlistPosition(creatorID string, creationTimestamp string, userID string) (int, float64) {
+	res, err := http.Get(testServer.URL + "/workshop/waitlist/" + creatorID + "/" + creationTimestamp + "/" + userID)
+	if err != nil {
+		log.Fatalf("Failed to send the HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+	var body map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		log.Fatalf("Failed to decode the response body: %v", err)
+	}
+	position, _ := body["Position"].(float64)
+	return res.StatusCode, position
+}
+
+func TestWaitlist(t *testing.T) {
+	workshop := models.Workshop{
+		Creator_Id:            "waitlist",
+		Creation_Timestamp:    "2023-11-06-10:00:00.000",
+		Title:                 "Single seat workshop",
+		Vacancies:             1,
+		Attendees:             []string{},
+		Registration_Deadline: "2099-02-08-23:59:59.000",
+		Start_Timestamp:       "2099-02-15-15:00:00.000",
+	}
+	if err := testStore.Put(context.Background(), workshop); err != nil {
+		log.Fatalf("Failed to seed the workshop in TestWaitlist: %v", err)
+	}
+	registerURL := testServer.URL + "/workshop/register/waitlist/2023-11-06-10:00:00.000"
+
+	res, _ := sendPatch(registerURL, map[string]interface{}{"User_Id": "a"})
+	assert.Equal(t, 200, res.StatusCode)
+
+	// the workshop is full, so the next users queue up in order
+	res, body := sendPatch(registerURL, map[string]interface{}{"User_Id": "b"})
+	assert.Equal(t, 202, res.StatusCode)
+	assert.Equal(t, float64(1), body["Position"])
+	res, body = sendPatch(registerURL, map[string]interface{}{"User_Id": "c"})
+	assert.Equal(t, 202, res.StatusCode)
+	assert.Equal(t, float64(2), body["Position"])
+
+	res, _ = sendPatch(registerURL, map[string]interface{}{"User_Id": "c"})
+	assert.Equal(t, 400, res.StatusCode)
+
+	status, position := getWaitlistPosition("waitlist", "2023-11-06-10:00:00.000", "c")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(2), position)
+
+	// withdrawing promotes the head of the waitlist into the freed seat
+	res, _ = sendPatch(testServer.URL+"/workshop/withdraw/waitlist/2023-11-06-10:00:00.000", map[string]interface{}{"User_Id": "a"})
+	assert.Equal(t, 200, res.StatusCode)
+	result, err := testStore.Get(context.Background(), "waitlist", "2023-11-06-10:00:00.000")
+	if err != nil {
+		log.Fatalf("Failed to read back the workshop in TestWaitlist: %v", err)
+	}
+	assert.Equal(t, []string{"b"}, result.Attendees)
+	assert.Equal(t, []string{"c"}, result.Waitlist)
+	assert.Equal(t, int64(0), result.Vacancies)
+
+	status, position = getWaitlistPosition("waitlist", "2023-11-06-10:00:00.000", "c")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, float64(1), position)
+
+	res, _ = sendPatch(testServer.URL+"/workshop/waitlist/leave/waitlist/2023-11-06-10:00:00.000", map[string]interface{}{"User_Id": "c"})
+	assert.Equal(t, 200, res.StatusCode)
+	status, _ = getWaitlistPosition("waitlist", "2023-11-06-10:00:00.000", "c")
+	assert.Equal(t, 404, status)
+}
+
+func TestCreateStartsWithAnEmptyWaitlist(t *testing.T) {
+	handler := newHandler(testStore, routes.Options{})
+	schedule := `"Registration_Deadline": "2099-02-08T23:59:59Z", "Start_Timestamp": "2099-02-15T15:00:00Z"`
+
+	rec := serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "forger", "Vacancies": 2, "Waitlist": ["victim"], "Version": 42, `+schedule+`}`)
+	assert.Equal(t, 201, rec.Code)
+	var created map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	workshop, err := testStore.GetByID(context.Background(), created["Workshop_Id"])
+	assert.NoError(t, err)
+	assert.Empty(t, workshop.Waitlist)
+	assert.NotEqual(t, int64(42), workshop.Version)
+	registrations, err := testStore.ListRegistrations(context.Background(), "victim")
+	assert.NoError(t, err)
+	assert.Empty(t, registrations)
+
+	for _, vacancies := range []string{"-5", "10001"} {
+		rec = serveRequest(handler, http.MethodPost, "/workshop", `{"Creator_Id": "forger", "Vacancies": `+vacancies+`, `+schedule+`}`)
+		assert.Equal(t, 400, rec.Code, vacancies)
+		assert.Contains(t, rec.Body.String(), "Vacancies must be between 0 and 10000")
+	}
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"workshop/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkshopIDRoutes(t *testing.T) {
+	res, body := sendRequest(http.MethodPost, testServer.URL+"/workshop", map[string]interface{}{
+		"Creator_Id":            "ids",
+		"Title":                 "Addressed by id",
+		"Vacancies":             1,
+		"Registration_Deadline": "2099-02-08-23:59:59.000",
+		"Start_Timestamp":       "2099-02-15-15:00:00.000",
+	}, nil)
+	assert.Equal(t, 201, res.StatusCode)
+	id, _ := body["Workshop_Id"].(string)
+	assert.NotEmpty(t, id)
+	assert.Equal(t, "/workshop/id/"+id, res.Header.Get("Location"))
+	creationTimestamp, _ := body["Creation_Timestamp"].(string)
+
+	url := testServer.URL + "/workshop/id/" + id
+	res, body = sendRequest(http.MethodGet, url, nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "Addressed by id", body["Title"])
+	assert.Equal(t, id, body["Workshop_Id"])
+
+	res, _ = sendPatch(url, map[string]interface{}{"Title": "Renamed by id"})
+	assert.Equal(t, 200, res.StatusCode)
+	res, _ = sendPatch(url+"/register", map[string]interface{}{"User_Id": "i1"})
+	assert.Equal(t, 200, res.StatusCode)
+	res, body = sendPatch(url+"/register", map[string]interface{}{"User_Id": "i2"})
+	assert.Equal(t, 202, res.StatusCode)
+	res, body = sendRequest(http.MethodGet, url+"/waitlist/i2", nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, float64(1), body["Position"])
+	res, _ = sendPatch(url+"/waitlist/leave", map[string]interface{}{"User_Id": "i2"})
+	assert.Equal(t, 200, res.StatusCode)
+	res, _ = sendPatch(url+"/withdraw", map[string]interface{}{"User_Id": "i1"})
+	assert.Equal(t, 200, res.StatusCode)
+
+	// the composite key routes still reach the same workshop
+	res, body = sendRequest(http.MethodGet, testServer.URL+"/workshop/ids/"+creationTimestamp, nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, id, body["Workshop_Id"])
+	assert.Equal(t, "Renamed by id", body["Title"])
+
+	res, _ = sendRequest(http.MethodDelete, url, nil, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	res, _ = sendRequest(http.MethodGet, url, nil, nil)
+	assert.Equal(t, 404, res.StatusCode)
+	res, _ = sendPatch(url+"/register", map[string]interface{}{"User_Id": "i1"})
+	assert.Equal(t, 404, res.StatusCode)
+}
+
+func TestConcurrentCreatesGetDistinctIDs(t *testing.T) {
+	const creates = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ids := map[string]bool{}
+	timestamps := map[string]bool{}
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, body := sendRequest(http.MethodPost, testServer.URL+"/workshop", map[string]interface{}{
+				"Creator_Id":            "burst",
+				"Title":                 "Created at once",
+				"Vacancies":             1,
+				"Registration_Deadline": "2099-02-08-23:59:59.000",
+				"Start_Timestamp":       "2099-02-15-15:00:00.000",
+			}, nil)
+			if res.StatusCode != 201 {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			ids[body["Workshop_Id"].(string)] = true
+			timestamps[body["Creation_Timestamp"].(string)] = true
+		}()
+	}
+	wg.Wait()
+
+	// a create may still fail once its retries run out, but none may
+	// overwrite another
+	assert.Equal(t, len(ids), len(timestamps))
+	page, err := testStore.ListByCreator(context.Background(), "burst", store.ListOptions{Limit: store.MaxPageSize})
+	assert.NoError(t, err)
+	assert.Len(t, page.Workshops, len(ids))
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DynamoDBStartHandler starts a span for a DynamoDB call, covering all of its
+// retries. Add it to the front of a client's Validate handlers, and
+// DynamoDBEndHandler to its Complete handlers.
+var DynamoDBStartHandler = request.NamedHandler{
+	Name: "workshop.tracing.DynamoDBStart",
+	Fn: func(r *request.Request) {
+		attributes := []attribute.KeyValue{
+			semconv.DBSystemDynamoDB,
+			semconv.RPCSystemKey.String("aws-api"),
+			semconv.RPCServiceKey.String("DynamoDB"),
+			semconv.RPCMethodKey.String(r.Operation.Name),
+		}
+		if table := tableName(r.Params); table != "" {
+			attributes = append(attributes, semconv.AWSDynamoDBTableNamesKey.StringSlice([]string{table}))
+		}
+		ctx, _ := Tracer().Start(r.Context(), "DynamoDB."+r.Operation.Name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attributes...))
+		r.SetContext(ctx)
+	},
+}
+
+// DynamoDBEndHandler ends the span DynamoDBStartHandler started.
+var DynamoDBEndHandler = request.NamedHandler{
+	Name: "workshop.tracing.DynamoDBEnd",
+	Fn: func(r *request.Request) {
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attribute.Int("aws.retry_count", r.RetryCount))
+		if r.Error != nil {
+			code := "unknown"
+			var awsErr awserr.Error
+			if errors.As(r.Error, &awsErr) {
+				code = awsErr.Code()
+			}
+			span.RecordError(r.Error)
+			span.SetStatus(codes.Error, code)
+		}
+		span.End()
+	},
+}
+
+// tableName is the TableName of a single table operation's input.
+func tableName(params interface{}) string {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	field := v.Elem().FieldByName("TableName")
+	if !field.IsValid() || field.Kind() != reflect.Pointer || field.IsNil() || field.Elem().Kind() != reflect.String {
+		return ""
+	}
+	return field.Elem().String()
+}
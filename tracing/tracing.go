@@ -0,0 +1,97 @@
+// Package tracing records OpenTelemetry spans for requests, storage
+// operations and the DynamoDB calls they make, and exports them where the
+// configuration says.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	"workshop/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName  = "workshop"
+	serviceName = "workshop"
+)
+
+// Tracer is the tracer every span of the service is started with. Until
+// Install is called it records nothing.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Setup installs a tracer provider exporting to the exporter cfg names. The
+// returned function flushes and stops it, and should run before exiting.
+func Setup(ctx context.Context, cfg config.Config) (func(context.Context) error, error) {
+	// incoming trace context is passed on even when nothing is exported here
+	otel.SetTextMapPropagator(propagator)
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Tracing.Exporter {
+	case config.TracesStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case config.TracesOTLP:
+		exporter, err = otlptracehttp.New(ctx, otlpOptions(cfg.Tracing.OTLPEndpoint)...)
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating the %s trace exporter: %w", cfg.Tracing.Exporter, err)
+	}
+	provider := NewProvider(sdktrace.WithBatcher(exporter), cfg.Tracing.SampleRatio)
+	Install(provider)
+	return provider.Shutdown, nil
+}
+
+// propagator reads and writes W3C trace context and baggage headers.
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// NewProvider returns a tracer provider for the service that hands its spans
+// to processor, e.g. sdktrace.WithSyncer(tracetest.NewInMemoryExporter()) in
+// tests. Traces begun here are sampled at sampleRatio; the rest follow the
+// caller's decision.
+func NewProvider(processor sdktrace.TracerProviderOption, sampleRatio float64) *sdktrace.TracerProvider {
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))
+	return sdktrace.NewTracerProvider(
+		processor,
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+}
+
+// Install makes provider the one Tracer uses, and W3C trace context the way
+// traces are propagated.
+func Install(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+}
+
+// otlpOptions points the OTLP exporter at endpoint. Without one, the
+// exporter reads the OTEL_EXPORTER_OTLP_* variables itself.
+func otlpOptions(endpoint string) []otlptracehttp.Option {
+	if endpoint == "" {
+		return nil
+	}
+	// the configuration has already checked the URL
+	u, _ := url.Parse(endpoint)
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if u.Path != "" && u.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(u.Path))
+	}
+	return options
+}